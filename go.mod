@@ -1,3 +1,3 @@
 module github.com/mjgaga/go_mutils
 
-go 1.13
+go 1.15
@@ -0,0 +1,290 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider adds credentials to an outgoing request, which is already a
+// copy owned by the provider.
+type AuthProvider interface {
+	Authenticate(req *http.Request) error
+}
+
+// TokenInvalidator is implemented by providers whose credentials can expire
+// early. On a 401 the cached token is dropped and the request sent once more.
+type TokenInvalidator interface {
+	InvalidateToken(req *http.Request)
+}
+
+type AuthProviderFunc func(req *http.Request) error
+
+func (f AuthProviderFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+func WithAuth(provider AuthProvider) Option {
+	return WithMiddleware(Auth(provider))
+}
+
+func Auth(provider AuthProvider) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// credentials stay with the origin the caller asked for
+			if isCrossOriginRedirect(req) {
+				return next.RoundTrip(req)
+			}
+
+			authed := req.Clone(req.Context())
+			if err := provider.Authenticate(authed); err != nil {
+				closeRequestBody(req)
+				return nil, err
+			}
+
+			res, err := next.RoundTrip(authed)
+			invalidator, ok := provider.(TokenInvalidator)
+			if err != nil || res.StatusCode != http.StatusUnauthorized || !ok {
+				return res, err
+			}
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				return res, err
+			}
+
+			invalidator.InvalidateToken(authed)
+			retry := req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return res, nil
+				}
+				retry.Body = body
+			}
+			if err := provider.Authenticate(retry); err != nil {
+				closeRequestBody(retry)
+				return res, nil
+			}
+
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4<<10))
+			res.Body.Close()
+			return next.RoundTrip(retry)
+		})
+	}
+}
+
+func BasicAuth(username, password string) AuthProvider {
+	return AuthProviderFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+func BearerToken(token string) AuthProvider {
+	return AuthProviderFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// APIKey sends key in header, e.g. APIKey("X-Api-Key", key).
+func APIKey(header, key string) AuthProvider {
+	return AuthProviderFunc(func(req *http.Request) error {
+		req.Header.Set(header, key)
+		return nil
+	})
+}
+
+// APIKeyQuery sends key as the query parameter param.
+func APIKeyQuery(param, key string) AuthProvider {
+	return AuthProviderFunc(func(req *http.Request) error {
+		u := *req.URL
+		query := u.Query()
+		query.Set(param, key)
+		u.RawQuery = query.Encode()
+		req.URL = &u
+		return nil
+	})
+}
+
+const DefaultTokenExpiryDelta = time.Second * 10
+
+// ClientCredentials implements the OAuth2 client-credentials grant. The token
+// is fetched on first use, cached until ExpiryDelta before it expires and
+// fetched again by a single request that every caller waits for, each able
+// to give up through its own context.
+type ClientCredentials struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams url.Values
+	// HTTPClient talks to the token endpoint, a client with DefaultTimeout when nil.
+	HTTPClient  *http.Client
+	ExpiryDelta time.Duration
+
+	mu          sync.Mutex
+	accessToken string
+	tokenType   string
+	expiry      time.Time
+	refresh     *tokenRefresh
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func NewClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+	}
+}
+
+func (c *ClientCredentials) Authenticate(req *http.Request) error {
+	token, tokenType, err := c.token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", tokenType+" "+token)
+	return nil
+}
+
+func (c *ClientCredentials) InvalidateToken(req *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another request may already have refreshed it
+	if req.Header.Get("Authorization") == c.tokenType+" "+c.accessToken {
+		c.accessToken = ""
+	}
+}
+
+// Token returns a valid access token, fetching a new one when needed.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	token, _, err := c.token(ctx)
+	return token, err
+}
+
+func (c *ClientCredentials) token(ctx context.Context) (string, string, error) {
+	c.mu.Lock()
+	delta := c.ExpiryDelta
+	if delta <= 0 {
+		delta = DefaultTokenExpiryDelta
+	}
+	if c.accessToken != "" && (c.expiry.IsZero() || time.Now().Add(delta).Before(c.expiry)) {
+		defer c.mu.Unlock()
+		return c.accessToken, c.tokenType, nil
+	}
+
+	refresh := c.refresh
+	if refresh == nil {
+		refresh = &tokenRefresh{done: make(chan struct{})}
+		c.refresh = refresh
+		go c.refreshToken(refresh)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	case <-refresh.done:
+		return refresh.accessToken, refresh.tokenType, refresh.err
+	}
+}
+
+// tokenRefresh is a fetch shared by every caller that needs a new token.
+type tokenRefresh struct {
+	done        chan struct{}
+	accessToken string
+	tokenType   string
+	err         error
+}
+
+// refreshToken fetches on its own context, so a caller giving up does not
+// fail the others waiting for the same token.
+func (c *ClientCredentials) refreshToken(refresh *tokenRefresh) {
+	timeout := DefaultTimeout
+	if c.HTTPClient != nil && c.HTTPClient.Timeout > 0 {
+		timeout = c.HTTPClient.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tok, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	if err == nil {
+		c.accessToken = tok.AccessToken
+		c.tokenType = tok.TokenType
+		if c.tokenType == "" || strings.EqualFold(c.tokenType, "bearer") {
+			c.tokenType = "Bearer"
+		}
+		c.expiry = time.Time{}
+		if tok.ExpiresIn > 0 {
+			c.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+		}
+		refresh.accessToken, refresh.tokenType = c.accessToken, c.tokenType
+	}
+	refresh.err = err
+	c.refresh = nil
+	c.mu.Unlock()
+
+	close(refresh.done)
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (*tokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	for key, values := range c.EndpointParams {
+		form[key] = values
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(ContextTypeHeaderForm.Key, ContextTypeHeaderForm.Value)
+	req.Header.Set(AcceptHeaderJson.Key, AcceptHeaderJson.Value)
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("oauth2: token request failed with status %d: %s", res.StatusCode, truncate(body, maxErrorBodySize))
+	}
+
+	tok := &tokenResponse{}
+	if err := json.Unmarshal(body, tok); err != nil {
+		return nil, fmt.Errorf("oauth2: cannot parse token response: %v", err)
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2: server response missing access_token")
+	}
+	return tok, nil
+}
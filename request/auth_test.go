@@ -0,0 +1,226 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer issues tok-1, tok-2, ... and lets a test hold requests until release is closed.
+type tokenServer struct {
+	*httptest.Server
+	fetches int32
+	release chan struct{}
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	ts := &tokenServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ts.release != nil {
+			<-ts.release
+		}
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&ts.fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("tok-%d", n),
+			"token_type":   "bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestClientCredentialsCachesToken(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	client, err := New(WithAuth(NewClientCredentials(tokens.URL, "client", "secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		res, err := client.GetResponse(context.Background(), api.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(res.Body); got != "Bearer tok-1" {
+			t.Fatalf("request %d sent %q, want %q", i, got, "Bearer tok-1")
+		}
+	}
+	if n := atomic.LoadInt32(&tokens.fetches); n != 1 {
+		t.Fatalf("token fetched %d times, want 1", n)
+	}
+}
+
+func TestClientCredentialsRefetchesExpiredToken(t *testing.T) {
+	// expires_in below ExpiryDelta is stale as soon as it arrives
+	tokens := newTokenServer(t, 1)
+	creds := NewClientCredentials(tokens.URL, "client", "secret")
+
+	for _, want := range []string{"tok-1", "tok-2"} {
+		got, err := creds.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestClientCredentialsConcurrentRefresh(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	tokens.release = make(chan struct{})
+	creds := NewClientCredentials(tokens.URL, "client", "secret")
+
+	var wg sync.WaitGroup
+	results := make(chan string, 20)
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := creds.Token(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			results <- token
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(tokens.release)
+	wg.Wait()
+	close(results)
+
+	for token := range results {
+		if token != "tok-1" {
+			t.Fatalf("got %q, want tok-1", token)
+		}
+	}
+	if n := atomic.LoadInt32(&tokens.fetches); n != 1 {
+		t.Fatalf("token fetched %d times, want 1", n)
+	}
+}
+
+func TestClientCredentialsWaiterCanGiveUp(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	tokens.release = make(chan struct{})
+	creds := NewClientCredentials(tokens.URL, "client", "secret")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := creds.Token(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("canceled waiter returned after %s", elapsed)
+	}
+
+	// the fetch carries on for the callers still waiting
+	done := make(chan string)
+	go func() {
+		token, _ := creds.Token(context.Background())
+		done <- token
+	}()
+	close(tokens.release)
+	if token := <-done; token != "tok-1" {
+		t.Fatalf("got %q, want tok-1", token)
+	}
+}
+
+func TestClientCredentialsRetriesOnce401(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	var calls int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Authorization") != "Bearer tok-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer api.Close()
+
+	client, err := New(WithAuth(NewClientCredentials(tokens.URL, "client", "secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.PostResponse(context.Background(), api.URL, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", res.StatusCode)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("api called %d times, want 2", n)
+	}
+	if n := atomic.LoadInt32(&tokens.fetches); n != 2 {
+		t.Fatalf("token fetched %d times, want 2", n)
+	}
+}
+
+func TestClientCredentialsTokenError(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	creds := NewClientCredentials(tokens.URL, "client", "wrong")
+	if _, err := creds.Token(context.Background()); err == nil {
+		t.Fatal("expected an error for rejected credentials")
+	}
+}
+
+func TestStaticAuthProviders(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider AuthProvider
+		check    func(r *http.Request) bool
+	}{
+		{"basic", BasicAuth("user", "pass"), func(r *http.Request) bool {
+			user, pass, ok := r.BasicAuth()
+			return ok && user == "user" && pass == "pass"
+		}},
+		{"bearer", BearerToken("abc"), func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer abc"
+		}},
+		{"api key", APIKey("X-Api-Key", "k"), func(r *http.Request) bool {
+			return r.Header.Get("X-Api-Key") == "k"
+		}},
+		{"api key query", APIKeyQuery("key", "k"), func(r *http.Request) bool {
+			return r.URL.Query().Get("key") == "k" && r.URL.Query().Get("q") == "1"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ok = tt.check(r)
+			}))
+			defer server.Close()
+
+			client, err := New(WithAuth(tt.provider))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.GetResponse(context.Background(), server.URL+"?q=1"); err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("credentials not sent")
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerWindow           = time.Minute
+	DefaultBreakerCoolDown         = time.Second * 30
+	DefaultBreakerHalfOpenRequests = 1
+
+	breakerBuckets = 10
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitOpenError is returned without touching the network while the
+// circuit of Host is open. It matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	Host    string
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open for %s until %s", e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerSettings configures a CircuitBreaker. Zero fields fall back to the
+// DefaultBreaker* values.
+type BreakerSettings struct {
+	// FailureThreshold failures within Window open the circuit.
+	FailureThreshold int
+	// FailureRatio, when set, additionally requires that share of failures
+	// among at least MinRequests requests within Window.
+	FailureRatio float64
+	MinRequests  int
+	Window       time.Duration
+	// CoolDown is how long the circuit stays open before probing.
+	CoolDown time.Duration
+	// HalfOpenRequests probes must all succeed to close the circuit again.
+	HalfOpenRequests int
+	// IsFailure classifies a round trip, by default transport errors other
+	// than cancellation and 5xx responses count.
+	IsFailure     func(res *http.Response, err error) bool
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+// CircuitBreaker keeps one circuit per host. It can be shared by several clients.
+type CircuitBreaker struct {
+	settings BreakerSettings
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	changes  []stateChange
+}
+
+type stateChange struct {
+	host     string
+	from, to CircuitState
+}
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+type circuit struct {
+	state    CircuitState
+	openedAt time.Time
+	buckets  [breakerBuckets]bucket
+
+	// generation changes with every state change, so results of requests
+	// admitted under an earlier state are not counted against the current one
+	generation int
+	probes     int
+	successes  int
+}
+
+// admission is what allow handed out to a request, record needs it back.
+type admission struct {
+	generation int
+	probe      bool
+}
+
+func NewCircuitBreaker(settings BreakerSettings) *CircuitBreaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if settings.Window <= 0 {
+		settings.Window = DefaultBreakerWindow
+	}
+	if settings.CoolDown <= 0 {
+		settings.CoolDown = DefaultBreakerCoolDown
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+	}
+	if settings.IsFailure == nil {
+		settings.IsFailure = isBreakerFailure
+	}
+	return &CircuitBreaker{settings: settings, circuits: map[string]*circuit{}}
+}
+
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return WithMiddleware(breaker.Middleware())
+}
+
+func isBreakerFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return res.StatusCode >= http.StatusInternalServerError
+}
+
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	c, ok := cb.circuits[host]
+	if !ok {
+		return CircuitClosed
+	}
+	cb.advance(host, c, time.Now())
+	return c.state
+}
+
+func (cb *CircuitBreaker) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			host := req.URL.Host
+			adm, err := cb.allow(host)
+			if err != nil {
+				closeRequestBody(req)
+				return nil, err
+			}
+
+			res, err := next.RoundTrip(req)
+			if errors.Is(err, context.Canceled) {
+				// the caller gave up, which says nothing about the host
+				cb.release(host, adm)
+			} else {
+				cb.record(host, adm, cb.settings.IsFailure(res, err))
+			}
+			return res, err
+		})
+	}
+}
+
+func (cb *CircuitBreaker) allow(host string) (admission, error) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	c, ok := cb.circuits[host]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[host] = c
+	}
+
+	now := time.Now()
+	cb.advance(host, c, now)
+	adm := admission{generation: c.generation}
+	switch c.state {
+	case CircuitOpen:
+		return adm, &CircuitOpenError{Host: host, RetryAt: c.openedAt.Add(cb.settings.CoolDown)}
+	case CircuitHalfOpen:
+		if c.probes >= cb.settings.HalfOpenRequests {
+			return adm, &CircuitOpenError{Host: host, RetryAt: now}
+		}
+		c.probes++
+		adm.probe = true
+	}
+	return adm, nil
+}
+
+// release hands back the probe slot of a request whose result is not counted.
+func (cb *CircuitBreaker) release(host string, adm admission) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	c := cb.circuits[host]
+	if adm.probe && c.generation == adm.generation {
+		c.probes--
+	}
+}
+
+func (cb *CircuitBreaker) record(host string, adm admission, failed bool) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	c := cb.circuits[host]
+	now := time.Now()
+	if c.generation != adm.generation {
+		return
+	}
+
+	switch c.state {
+	case CircuitHalfOpen:
+		if failed {
+			cb.setState(host, c, CircuitOpen, now)
+			return
+		}
+		c.successes++
+		if c.successes >= cb.settings.HalfOpenRequests {
+			cb.setState(host, c, CircuitClosed, now)
+		}
+	case CircuitClosed:
+		b := cb.currentBucket(c, now)
+		b.total++
+		if failed {
+			b.failures++
+			if cb.shouldTrip(c, now) {
+				cb.setState(host, c, CircuitOpen, now)
+			}
+		}
+	}
+}
+
+// advance moves an open circuit to half-open once the cool-down is over.
+func (cb *CircuitBreaker) advance(host string, c *circuit, now time.Time) {
+	if c.state == CircuitOpen && !now.Before(c.openedAt.Add(cb.settings.CoolDown)) {
+		cb.setState(host, c, CircuitHalfOpen, now)
+	}
+}
+
+func (cb *CircuitBreaker) setState(host string, c *circuit, state CircuitState, now time.Time) {
+	from := c.state
+	c.state = state
+	c.generation++
+	c.probes, c.successes = 0, 0
+	if state == CircuitOpen {
+		c.openedAt = now
+	}
+	if state == CircuitClosed {
+		c.buckets = [breakerBuckets]bucket{}
+	}
+	if cb.settings.OnStateChange != nil && from != state {
+		cb.changes = append(cb.changes, stateChange{host: host, from: from, to: state})
+	}
+}
+
+// unlock releases the lock before running OnStateChange, so callbacks may
+// call back into the breaker.
+func (cb *CircuitBreaker) unlock() {
+	changes := cb.changes
+	cb.changes = nil
+	cb.mu.Unlock()
+
+	for _, change := range changes {
+		cb.settings.OnStateChange(change.host, change.from, change.to)
+	}
+}
+
+// bucketWidth is at least a nanosecond, a Window shorter than breakerBuckets
+// nanoseconds would otherwise divide by zero.
+func (cb *CircuitBreaker) bucketWidth() time.Duration {
+	if width := cb.settings.Window / breakerBuckets; width > 0 {
+		return width
+	}
+	return 1
+}
+
+func (cb *CircuitBreaker) currentBucket(c *circuit, now time.Time) *bucket {
+	width := cb.bucketWidth()
+	start := now.Truncate(width)
+	b := &c.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	return b
+}
+
+func (cb *CircuitBreaker) shouldTrip(c *circuit, now time.Time) bool {
+	var total, failures int
+	oldest := now.Add(-cb.settings.Window)
+	for _, b := range c.buckets {
+		if b.start.After(oldest) {
+			total += b.total
+			failures += b.failures
+		}
+	}
+
+	if failures < cb.settings.FailureThreshold {
+		return false
+	}
+	if cb.settings.FailureRatio > 0 {
+		return total >= cb.settings.MinRequests && float64(failures)/float64(total) >= cb.settings.FailureRatio
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func breakerRoundTrip(breaker *CircuitBreaker, ctx context.Context, status int, err error) error {
+	rt := breaker.Middleware()(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	}))
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil).WithContext(ctx)
+	_, err = rt.RoundTrip(req)
+	return err
+}
+
+func TestCircuitBreakerTinyWindow(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerSettings{FailureThreshold: 1, Window: 5 * time.Nanosecond})
+	breakerRoundTrip(breaker, context.Background(), http.StatusInternalServerError, nil)
+	if state := breaker.State("example.com"); state != CircuitOpen {
+		t.Fatalf("state %s, want open", state)
+	}
+}
+
+func TestCircuitBreakerCanceledProbe(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerSettings{FailureThreshold: 1, CoolDown: 50 * time.Millisecond})
+	breakerRoundTrip(breaker, context.Background(), http.StatusInternalServerError, nil)
+	time.Sleep(60 * time.Millisecond)
+	if state := breaker.State("example.com"); state != CircuitHalfOpen {
+		t.Fatalf("state %s, want half-open", state)
+	}
+
+	if err := breakerRoundTrip(breaker, context.Background(), 0, context.Canceled); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if state := breaker.State("example.com"); state != CircuitHalfOpen {
+		t.Fatalf("canceled probe moved the circuit to %s", state)
+	}
+
+	// the canceled probe gave its slot back
+	if err := breakerRoundTrip(breaker, context.Background(), http.StatusOK, nil); err != nil {
+		t.Fatal(err)
+	}
+	if state := breaker.State("example.com"); state != CircuitClosed {
+		t.Fatalf("state %s, want closed", state)
+	}
+}
+
+func TestCircuitBreakerIgnoresStaleResults(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerSettings{FailureThreshold: 1, CoolDown: 50 * time.Millisecond})
+	started, finish := make(chan struct{}), make(chan struct{})
+	rt := breaker.Middleware()(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("X-Slow") != "" {
+			close(started)
+			<-finish
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}))
+
+	// a request admitted while closed is still running when the circuit opens
+	slow := make(chan error)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("X-Slow", "1")
+		_, err := rt.RoundTrip(req)
+		slow <- err
+	}()
+	<-started
+	breakerRoundTrip(breaker, context.Background(), http.StatusInternalServerError, nil)
+	time.Sleep(60 * time.Millisecond)
+	if state := breaker.State("example.com"); state != CircuitHalfOpen {
+		t.Fatalf("state %s, want half-open", state)
+	}
+
+	close(finish)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+	if state := breaker.State("example.com"); state != CircuitHalfOpen {
+		t.Fatalf("a result from before the circuit opened moved it to %s", state)
+	}
+
+	err := breakerRoundTrip(breaker, context.Background(), http.StatusInternalServerError, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := breaker.State("example.com"); state != CircuitOpen {
+		t.Fatalf("state %s, want open after a failed probe", state)
+	}
+	if err := breakerRoundTrip(breaker, context.Background(), http.StatusOK, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want %v", err, ErrCircuitOpen)
+	}
+}
@@ -0,0 +1,442 @@
+package request
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultCacheEntries      = 1000
+	DefaultCacheMaxEntrySize = 1 << 20
+
+	// CacheStatusHeader tells whether a response came from the cache:
+	// HIT, REVALIDATED or MISS.
+	CacheStatusHeader = "X-Cache"
+)
+
+// CacheStore keeps serialized responses. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, entry []byte)
+	Delete(key string)
+}
+
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Revalidations int64
+}
+
+// Cache is a private HTTP cache for GET requests following RFC 7234:
+// max-age, Expires, no-store and no-cache are honoured and stale entries with
+// an ETag or Last-Modified are revalidated with a conditional request.
+// Responses to requests with an Authorization header are only stored when
+// they allow shared caching with public, must-revalidate or s-maxage; add
+// WithAuth before WithCache so the cache sees the header.
+type Cache struct {
+	store        CacheStore
+	maxEntrySize int64
+
+	hits          int64
+	misses        int64
+	revalidations int64
+}
+
+type cacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Stored     time.Time
+	// Vary holds the request header values named by the Vary response header.
+	Vary map[string]string
+}
+
+func NewCache(store CacheStore) *Cache {
+	return &Cache{store: store, maxEntrySize: DefaultCacheMaxEntrySize}
+}
+
+// SetMaxEntrySize skips storing responses with larger bodies.
+func (c *Cache) SetMaxEntrySize(size int64) *Cache {
+	c.maxEntrySize = size
+	return c
+}
+
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:          atomic.LoadInt64(&c.hits),
+		Misses:        atomic.LoadInt64(&c.misses),
+		Revalidations: atomic.LoadInt64(&c.revalidations),
+	}
+}
+
+func WithCache(cache *Cache) Option {
+	return WithMiddleware(cache.Middleware())
+}
+
+func (c *Cache) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return c.roundTrip(next, req)
+		})
+	}
+}
+
+func (c *Cache) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+
+	if req.Method != http.MethodGet {
+		res, err := next.RoundTrip(req)
+		// unsafe methods invalidate what we know about the target
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && res.StatusCode < http.StatusBadRequest {
+			c.store.Delete(key)
+		}
+		return res, err
+	}
+
+	reqDirectives := parseCacheControl(req.Header)
+	if _, ok := reqDirectives["no-store"]; ok {
+		atomic.AddInt64(&c.misses, 1)
+		return next.RoundTrip(req)
+	}
+
+	entry := c.load(key, req)
+	if entry == nil {
+		atomic.AddInt64(&c.misses, 1)
+		return c.fetch(next, req, key, nil)
+	}
+
+	_, noCache := reqDirectives["no-cache"]
+	if !noCache && entry.fresh(time.Now()) {
+		atomic.AddInt64(&c.hits, 1)
+		return entry.response(req, "HIT"), nil
+	}
+
+	etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		atomic.AddInt64(&c.misses, 1)
+		return c.fetch(next, req, key, nil)
+	}
+
+	conditional := req.Clone(req.Context())
+	if etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+	return c.fetch(next, conditional, key, entry)
+}
+
+func (c *Cache) fetch(next http.RoundTripper, req *http.Request, key string, stale *cacheEntry) (*http.Response, error) {
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	if stale != nil && res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+		atomic.AddInt64(&c.revalidations, 1)
+		for k, v := range res.Header {
+			stale.Header[k] = v
+		}
+		stale.Header.Del("Age")
+		stale.Stored = time.Now()
+		c.save(key, stale)
+		return stale.response(req, "REVALIDATED"), nil
+	}
+	if stale != nil {
+		atomic.AddInt64(&c.misses, 1)
+	}
+
+	if !storable(req, res) {
+		res.Header.Set(CacheStatusHeader, "MISS")
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, c.maxEntrySize+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > c.maxEntrySize {
+		res.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(body), res.Body), Closer: res.Body}
+		res.Header.Set(CacheStatusHeader, "MISS")
+		return res, nil
+	}
+	res.Body.Close()
+
+	entry := &cacheEntry{
+		StatusCode: res.StatusCode,
+		Header:     res.Header.Clone(),
+		Body:       body,
+		Stored:     time.Now(),
+		Vary:       varyValues(res.Header, req.Header),
+	}
+	c.save(key, entry)
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.Header.Set(CacheStatusHeader, "MISS")
+	return res, nil
+}
+
+func (c *Cache) load(key string, req *http.Request) *cacheEntry {
+	data, ok := c.store.Get(key)
+	if !ok {
+		return nil
+	}
+
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		c.store.Delete(key)
+		return nil
+	}
+	for name, value := range entry.Vary {
+		if req.Header.Get(name) != value {
+			return nil
+		}
+	}
+	return entry
+}
+
+func (c *Cache) save(key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	c.store.Set(key, data)
+}
+
+func storable(req *http.Request, res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+
+	directives := parseCacheControl(res.Header)
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if strings.TrimSpace(res.Header.Get("Vary")) == "*" {
+		return false
+	}
+	// entries are keyed by URL alone, so a response to one set of credentials
+	// is only kept when the server says anyone may see it (RFC 7234 section 3.2)
+	if req.Header.Get("Authorization") != "" {
+		_, public := directives["public"]
+		_, mustRevalidate := directives["must-revalidate"]
+		_, sMaxAge := directives["s-maxage"]
+		if !public && !mustRevalidate && !sMaxAge {
+			return false
+		}
+	}
+	// without freshness information or validators the entry could never be used
+	_, hasMaxAge := directives["max-age"]
+	return hasMaxAge || res.Header.Get("Expires") != "" ||
+		res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""
+}
+
+func (entry *cacheEntry) fresh(now time.Time) bool {
+	directives := parseCacheControl(entry.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+
+	age := now.Sub(entry.Stored)
+	if initial, err := strconv.Atoi(entry.Header.Get("Age")); err == nil && initial > 0 {
+		age += time.Duration(initial) * time.Second
+	}
+
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		return err == nil && age < time.Duration(seconds)*time.Second
+	}
+
+	if expires := entry.Header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			return false
+		}
+		date := entry.Stored
+		if d, err := http.ParseTime(entry.Header.Get("Date")); err == nil {
+			date = d
+		}
+		return age < at.Sub(date)
+	}
+	return false
+}
+
+func (entry *cacheEntry) response(req *http.Request, status string) *http.Response {
+	header := entry.Header.Clone()
+	header.Set(CacheStatusHeader, status)
+	return &http.Response{
+		Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+func varyValues(resHeader, reqHeader http.Header) map[string]string {
+	vary := resHeader.Get("Vary")
+	if vary == "" {
+		return nil
+	}
+	values := map[string]string{}
+	for _, name := range strings.Split(vary, ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name != "" {
+			values[name] = reqHeader.Get(name)
+		}
+	}
+	return values
+}
+
+func parseCacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range header["Cache-Control"] {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, arg := part, ""
+			if i := strings.Index(part, "="); i >= 0 {
+				name, arg = part[:i], strings.Trim(part[i+1:], `"`)
+			}
+			directives[strings.ToLower(name)] = arg
+		}
+	}
+	return directives
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// MemoryCache is an LRU CacheStore holding at most maxEntries responses.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key  string
+	data []byte
+}
+
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheEntries
+	}
+	return &MemoryCache{maxEntries: maxEntries, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (m *MemoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).data, true
+}
+
+func (m *MemoryCache) Set(key string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		el.Value.(*memoryCacheItem).data = data
+		m.order.MoveToFront(el)
+		return
+	}
+	m.entries[key] = m.order.PushFront(&memoryCacheItem{key: key, data: data})
+	for m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		m.order.Remove(el)
+		delete(m.entries, key)
+	}
+}
+
+// DiskCache stores one file per response under dir, named after the hashed key.
+type DiskCache struct {
+	dir string
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (d *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+func (d *DiskCache) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (d *DiskCache) Set(key string, data []byte) {
+	tmp, err := ioutil.TempFile(d.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	// rename keeps readers from seeing half written entries
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+func (d *DiskCache) Delete(key string) {
+	os.Remove(d.path(key))
+}
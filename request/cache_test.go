@@ -0,0 +1,43 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCacheKeepsAuthorizedResponsesApart(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		wantBodies   []string
+	}{
+		{"private by default", "max-age=60", []string{"Bearer a", "Bearer b", "Bearer a"}},
+		{"public", "public, max-age=60", []string{"Bearer a", "Bearer a", "Bearer a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				w.Write([]byte(r.Header.Get("Authorization")))
+			}))
+			defer server.Close()
+
+			client, err := New(WithCache(NewCache(NewMemoryCache(DefaultCacheEntries))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, token := range []string{"a", "b", "a"} {
+				res, err := client.GetResponse(context.Background(), server.URL, &Header{Key: "Authorization", Value: "Bearer " + token})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := string(res.Body); got != tt.wantBodies[i] {
+					t.Fatalf("request %d got %q, want %q", i, got, tt.wantBodies[i])
+				}
+			}
+		})
+	}
+}
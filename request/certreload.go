@@ -0,0 +1,207 @@
+package request
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultCertReloadInterval = time.Minute
+
+// CertReloadEvent reports a rotation seen by the reloader. Err is nil when
+// the new material is in use, otherwise the previous material stays active
+// and the failure is reported on every poll until the files are fixed.
+type CertReloadEvent struct {
+	Files []string
+	Err   error
+}
+
+// WithCertReload re-reads the files given to WithCAFile, WithCAPaths and
+// WithClientCertFile every interval and swaps in changed material without
+// dropping the client. Material given as bytes, such as WithClientCert, is
+// used as it is. onEvent may be nil. Call Close on the client to stop polling.
+// Reloaded CAs are checked outside crypto/tls, which does not tell us the IP
+// address of a host dialed by address; name such hosts with WithExpectedNames.
+func WithCertReload(interval time.Duration, onEvent func(CertReloadEvent)) Option {
+	return func(o *options) {
+		if interval <= 0 {
+			interval = DefaultCertReloadInterval
+		}
+		o.certReload = &certReloadSettings{interval: interval, onEvent: onEvent}
+	}
+}
+
+type certReloadSettings struct {
+	interval time.Duration
+	onEvent  func(CertReloadEvent)
+}
+
+// certReloader holds the current CA pool and client certificate and polls
+// their files for changes.
+type certReloader struct {
+	caPaths   []string
+	loadRoots func(files []caFileData) (*x509.CertPool, error)
+	certFile  string
+	keyFile   string
+	password  string
+	onEvent   func(CertReloadEvent)
+
+	mu       sync.RWMutex
+	roots    *x509.CertPool
+	cert     *tls.Certificate
+	caData   []byte
+	certData []byte
+	keyData  []byte
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCertReloader(o *options) (*certReloader, error) {
+	r := &certReloader{
+		caPaths:   o.allCAPaths(),
+		loadRoots: o.rootPool,
+		certFile:  o.certFile,
+		keyFile:   o.keyFile,
+		password:  o.keyPassword,
+		onEvent:   o.certReload.onEvent,
+		stop:      make(chan struct{}),
+	}
+	if len(r.caPaths) == 0 {
+		// CAs that are not files never change
+		roots, err := o.rootPool(nil)
+		if err != nil {
+			return nil, err
+		}
+		r.roots = roots
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	go r.poll(o.certReload.interval)
+	return r, nil
+}
+
+func (r *certReloader) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			files, err := r.reload()
+			if len(files) > 0 && r.onEvent != nil {
+				r.onEvent(CertReloadEvent{Files: files, Err: err})
+			}
+		}
+	}
+}
+
+// reload reads the files and swaps in whatever changed and parses. It
+// returns the changed files, so nothing is reported while files stay the same.
+func (r *certReloader) reload() ([]string, error) {
+	var changed []string
+	var firstErr error
+
+	if len(r.caPaths) > 0 {
+		files, err := readCAPaths(r.caPaths)
+		switch {
+		case err != nil:
+			changed, firstErr = append(changed, r.caPaths...), err
+		case !bytes.Equal(caSnapshot(files), r.currentCA()):
+			changed = append(changed, r.caPaths...)
+			pool, err := r.loadRoots(files)
+			if err != nil {
+				firstErr = err
+				break
+			}
+			r.mu.Lock()
+			r.roots, r.caData = pool, caSnapshot(files)
+			r.mu.Unlock()
+		}
+	}
+
+	if r.certFile != "" {
+		certData, err := ioutil.ReadFile(r.certFile)
+		var keyData []byte
+		if err == nil {
+			keyData, err = ioutil.ReadFile(r.keyFile)
+		}
+		if err != nil {
+			changed = append(changed, r.certFile, r.keyFile)
+			if firstErr == nil {
+				firstErr = err
+			}
+			return changed, firstErr
+		}
+
+		oldCert, oldKey := r.currentPair()
+		if !bytes.Equal(certData, oldCert) || !bytes.Equal(keyData, oldKey) {
+			changed = append(changed, r.certFile, r.keyFile)
+			// a half rotated pair fails here and is retried on the next tick
+			cert, err := X509KeyPairWithPassword(certData, keyData, r.password)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return changed, firstErr
+			}
+			r.mu.Lock()
+			r.cert, r.certData, r.keyData = &cert, certData, keyData
+			r.mu.Unlock()
+		}
+	}
+
+	return changed, firstErr
+}
+
+// caSnapshot identifies the content of the CA files so changes, including
+// files added to or removed from a directory, can be detected.
+func caSnapshot(files []caFileData) []byte {
+	var b bytes.Buffer
+	// never empty, so an empty directory still differs from nothing loaded
+	b.WriteString(strconv.Itoa(len(files)))
+	for _, file := range files {
+		b.WriteString(file.path)
+		b.WriteByte(0)
+		b.Write(file.data)
+		b.WriteByte(0)
+	}
+	return b.Bytes()
+}
+
+func (r *certReloader) currentCA() []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.caData
+}
+
+func (r *certReloader) currentPair() ([]byte, []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certData, r.keyData
+}
+
+func (r *certReloader) currentRoots() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.roots
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	return nil
+}
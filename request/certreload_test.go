@@ -0,0 +1,364 @@
+package request
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert issues a certificate for hosts, names or IP addresses, signed
+// by parent or self-signed when parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert, hosts ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// newTLSServer answers with "ok" using server's certificate.
+func newTLSServer(t *testing.T, server *testCert) *httptest.Server {
+	pair, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// localhostURL dials ts by name, reloaded CAs cannot verify hosts dialed by address.
+func localhostURL(ts *httptest.Server) string {
+	return strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+}
+
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newMTLSServer answers with the common name of the client certificate.
+func newMTLSServer(t *testing.T, ca, server *testCert) *httptest.Server {
+	pair, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestCertReloadKeepsClientCertBytes(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	server := newMTLSServer(t, ca, newTestCert(t, "server", ca, "localhost"))
+	client := newTestCert(t, "client", ca)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, ca.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(WithCAFile(caFile), WithClientCert(client.certPEM, client.keyPEM), WithCertReload(time.Hour, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	res, err := c.GetResponse(context.Background(), localhostURL(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Body); got != "client" {
+		t.Fatalf("server saw client %q, want %q", got, "client")
+	}
+}
+
+func TestCertReloadRejectsBadClientCertBytes(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, ca.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(WithCAFile(caFile), WithClientCert([]byte("not a cert"), nil), WithCertReload(time.Hour, nil)); err == nil {
+		t.Fatal("expected an error for an unparsable client certificate")
+	}
+}
+
+func TestCertReloadVerifiesIPHosts(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	dir := t.TempDir()
+	caFile := writeTestFile(t, dir, "ca.pem", ca.certPEM)
+	client := newTestCert(t, "client", ca)
+	certFile := writeTestFile(t, dir, "client.pem", client.certPEM)
+	keyFile := writeTestFile(t, dir, "client.key", client.keyPEM)
+
+	// a certificate from the trusted CA, but not for the address dialed
+	other := newTLSServer(t, newTestCert(t, "server", ca, "foo.example"))
+	legacy, err := NewHttpsClientX509WithReload(caFile, certFile, keyFile, false, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+
+	tests := []struct {
+		name   string
+		client interface {
+			GetResponse(ctx context.Context, url string, headers ...*Header) (*Response, error)
+		}
+		opts []Option
+	}{
+		{"static CA", nil, []Option{WithCAFile(caFile)}},
+		{"reloaded CA", nil, []Option{WithCAFile(caFile), WithCertReload(time.Hour, nil)}},
+		{"reloaded CA with pin", nil, []Option{WithCAFile(caFile), WithCertReload(time.Hour, nil), WithPinnedKeys(PinAndCA, SPKIPin(ca.cert))}},
+		{"legacy reload constructor", legacy, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			if c == nil {
+				nc, err := New(tt.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer nc.Close()
+				c = nc
+			}
+			if _, err := c.GetResponse(context.Background(), other.URL); err == nil {
+				t.Fatal("accepted a certificate for another host")
+			}
+		})
+	}
+
+	// hosts dialed by address are named explicitly, hosts dialed by name just work
+	ipServer := newTLSServer(t, newTestCert(t, "server", ca, "127.0.0.1", "localhost"))
+	for _, tc := range []struct {
+		url  string
+		opts []Option
+	}{
+		{ipServer.URL, []Option{WithExpectedNames("127.0.0.1")}},
+		{localhostURL(ipServer), nil},
+	} {
+		c, err := New(append([]Option{WithCAFile(caFile), WithCertReload(time.Hour, nil)}, tc.opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetResponse(context.Background(), tc.url); err != nil {
+			t.Fatalf("%s: %v", tc.url, err)
+		}
+		c.Close()
+	}
+}
+
+// waitReload waits for a reload event that failed or succeeded as wanted,
+// skipping others such as a half written pair seen mid rotation.
+func waitReload(t *testing.T, events <-chan CertReloadEvent, wantErr bool) CertReloadEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if (ev.Err != nil) == wantErr {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no reload event with error %v", wantErr)
+		}
+	}
+}
+
+func newReloadEvents() (chan CertReloadEvent, func(CertReloadEvent)) {
+	events := make(chan CertReloadEvent, 100)
+	return events, func(ev CertReloadEvent) {
+		select {
+		case events <- ev:
+		default:
+		}
+	}
+}
+
+func TestCertReloadRotation(t *testing.T) {
+	oldCA, newCA := newTestCert(t, "old ca", nil), newTestCert(t, "new ca", nil)
+	oldServer := newMTLSServer(t, oldCA, newTestCert(t, "server", oldCA, "localhost"))
+	newServer := newMTLSServer(t, oldCA, newTestCert(t, "server", newCA, "localhost"))
+
+	dir := t.TempDir()
+	caFile := writeTestFile(t, dir, "ca.pem", oldCA.certPEM)
+	first := newTestCert(t, "first", oldCA)
+	certFile := writeTestFile(t, dir, "client.pem", first.certPEM)
+	keyFile := writeTestFile(t, dir, "client.key", first.keyPEM)
+
+	events, onEvent := newReloadEvents()
+	c, err := New(WithCAFile(caFile), WithClientCertFile(certFile, keyFile), WithKeepAlive(false), WithCertReload(10*time.Millisecond, onEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	expect := func(ts *httptest.Server, want string) {
+		t.Helper()
+		res, err := c.GetResponse(context.Background(), localhostURL(ts))
+		if want == "" {
+			if err == nil {
+				t.Fatal("accepted a server from an untrusted CA")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(res.Body); got != want {
+			t.Fatalf("server saw client %q, want %q", got, want)
+		}
+	}
+	expect(oldServer, "first")
+	expect(newServer, "")
+
+	second := newTestCert(t, "second", oldCA)
+	writeTestFile(t, dir, "client.pem", second.certPEM)
+	writeTestFile(t, dir, "client.key", second.keyPEM)
+	waitReload(t, events, false)
+	expect(oldServer, "second")
+
+	writeTestFile(t, dir, "ca.pem", newCA.certPEM)
+	if ev := waitReload(t, events, false); len(ev.Files) != 1 || ev.Files[0] != caFile {
+		t.Fatalf("event for %q, want %q", ev.Files, caFile)
+	}
+	expect(newServer, "second")
+	expect(oldServer, "")
+}
+
+func TestCertReloadKeepsLastGoodMaterial(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	server := newMTLSServer(t, ca, newTestCert(t, "server", ca, "localhost"))
+
+	dir := t.TempDir()
+	caFile := writeTestFile(t, dir, "ca.pem", ca.certPEM)
+	client := newTestCert(t, "client", ca)
+	certFile := writeTestFile(t, dir, "client.pem", client.certPEM)
+	keyFile := writeTestFile(t, dir, "client.key", client.keyPEM)
+
+	events, onEvent := newReloadEvents()
+	c, err := New(WithCAFile(caFile), WithClientCertFile(certFile, keyFile), WithKeepAlive(false), WithCertReload(10*time.Millisecond, onEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, name := range []string{"client.pem", "ca.pem"} {
+		writeTestFile(t, dir, name, []byte("not a certificate"))
+		waitReload(t, events, true)
+
+		res, err := c.GetResponse(context.Background(), localhostURL(server))
+		if err != nil {
+			t.Fatalf("broken %s: %v", name, err)
+		}
+		if got := string(res.Body); got != "client" {
+			t.Fatalf("broken %s: server saw client %q, want %q", name, got, "client")
+		}
+	}
+}
+
+func TestCertReloadCloseStopsPolling(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	dir := t.TempDir()
+	caFile := writeTestFile(t, dir, "ca.pem", ca.certPEM)
+
+	events, onEvent := newReloadEvents()
+	c, err := New(WithCAFile(caFile), WithCertReload(10*time.Millisecond, onEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "ca.pem", newTestCert(t, "other ca", nil).certPEM)
+	waitReload(t, events, false)
+
+	c.Close()
+	// let a poll already running when Close was called finish
+	time.Sleep(50 * time.Millisecond)
+	for len(events) > 0 {
+		<-events
+	}
+
+	writeTestFile(t, dir, "ca.pem", []byte("not a certificate"))
+	time.Sleep(100 * time.Millisecond)
+	if n := len(events); n != 0 {
+		t.Fatalf("got %d reload events after Close", n)
+	}
+}
@@ -0,0 +1,110 @@
+package request
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+type baseClient struct {
+	client http.Client
+	retry  *RetryPolicy
+
+	maxBodySize int64
+	jsonError   func() error
+	reloader    *certReloader
+	tracer      Tracer
+	metrics     MetricsRecorder
+	timing      bool
+	onTiming    func(info RequestInfo)
+}
+
+// Close stops background work such as certificate reloading and drops idle
+// connections. The client must not be used afterwards.
+func (client *baseClient) Close() error {
+	if client.reloader != nil {
+		client.reloader.Close()
+	}
+	client.client.CloseIdleConnections()
+	return nil
+}
+
+func (client *baseClient) Head(ctx context.Context, url string, headers ...*Header) (statusCode int, header http.Header, err error) {
+	res, err := client.Do(ctx, http.MethodHead, url, nil, headers...)
+	if res == nil {
+		return 0, nil, err
+	}
+
+	return res.StatusCode, res.Header, err
+}
+
+func (client *baseClient) Get(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
+	return unpack(client.Do(ctx, http.MethodGet, url, nil, headers...))
+}
+
+func (client *baseClient) Post(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
+	return unpack(client.Do(ctx, http.MethodPost, url, body, headers...))
+}
+
+func (client *baseClient) Patch(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
+	return unpack(client.Do(ctx, http.MethodPatch, url, body, headers...))
+}
+
+func (client *baseClient) Put(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
+	return unpack(client.Do(ctx, http.MethodPut, url, body, headers...))
+}
+
+func (client *baseClient) Delete(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
+	return unpack(client.Do(ctx, http.MethodDelete, url, nil, headers...))
+}
+
+// do sends the request and reports how many attempts it took. Errors are *RequestError.
+func (client *baseClient) do(ctx context.Context, method, rawURL string, body io.Reader, headers []*Header) (*http.Response, int, error) {
+	req, err := newRequest(ctx, method, rawURL, body, headers)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, obs := client.observe(req)
+	res, attempts, err := client.sendWithRetry(req)
+	if err != nil {
+		err = newRequestError(req.Method, req.URL, attempts, err)
+		obs.response(nil, attempts, err)
+		return nil, attempts, err
+	}
+	return obs.response(res, attempts, nil), attempts, nil
+}
+
+func newRequest(ctx context.Context, method, rawURL string, body io.Reader, headers []*Header) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err == nil && (u.Scheme == "" || u.Host == "") {
+		err = errMissingSchemeOrHost
+	}
+	if err != nil {
+		return nil, &RequestError{Method: method, URL: rawURL, Kind: KindInvalidURL, Err: err}
+	}
+
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, &RequestError{Method: method, URL: redactURL(u), Kind: KindInvalidURL, Err: err}
+	}
+	req = req.WithContext(ctx)
+
+	for _, head := range headers {
+		if head == nil {
+			continue
+		}
+		req.Header.Add(head.Key, head.Value)
+	}
+
+	return req, nil
+}
+
+func unpack(res *Response, err error) (resBody []byte, statusCode int, header http.Header, e error) {
+	if res == nil {
+		return nil, 0, nil, err
+	}
+
+	return res.Body, res.StatusCode, res.Header, err
+}
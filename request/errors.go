@@ -0,0 +1,179 @@
+package request
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+type ErrorKind int
+
+const (
+	KindUnknown ErrorKind = iota
+	KindInvalidURL
+	KindTimeout
+	KindDNS
+	KindTLS
+	KindConnectionRefused
+	KindCanceled
+	KindStatus
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindInvalidURL:
+		return "invalid url"
+	case KindTimeout:
+		return "timeout"
+	case KindDNS:
+		return "dns"
+	case KindTLS:
+		return "tls"
+	case KindConnectionRefused:
+		return "connection refused"
+	case KindCanceled:
+		return "canceled"
+	case KindStatus:
+		return "status"
+	}
+	return "unknown"
+}
+
+// Sentinels matching a *RequestError of the same kind with errors.Is.
+var (
+	ErrInvalidURL        = errors.New("invalid url")
+	ErrTimeout           = errors.New("request timed out")
+	ErrDNS               = errors.New("dns lookup failed")
+	ErrTLS               = errors.New("tls handshake failed")
+	ErrConnectionRefused = errors.New("connection refused")
+	ErrCanceled          = errors.New("request canceled")
+	ErrStatus            = errors.New("unexpected status")
+
+	errMissingSchemeOrHost = errors.New("missing scheme or host")
+)
+
+var kindErrors = map[ErrorKind]error{
+	KindInvalidURL:        ErrInvalidURL,
+	KindTimeout:           ErrTimeout,
+	KindDNS:               ErrDNS,
+	KindTLS:               ErrTLS,
+	KindConnectionRefused: ErrConnectionRefused,
+	KindCanceled:          ErrCanceled,
+	KindStatus:            ErrStatus,
+}
+
+// RequestError is returned by the client methods for failed requests and,
+// through EnsureSuccess, unexpected statuses. Err is the cause, a
+// *StatusError for KindStatus, otherwise what net/http returned with the
+// *url.Error layer removed. The JSON helpers pass other errors through
+// as they are: the json error when in does not encode or the response does
+// not decode into out, and the error built by WithJSONError for a decoded
+// error body.
+type RequestError struct {
+	Method string
+	URL    string
+	// Attempt is the attempt that failed, 0 when nothing was sent.
+	Attempt    int
+	StatusCode int
+	// Body is truncated, only set for KindStatus.
+	Body []byte
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *RequestError) Error() string {
+	msg := fmt.Sprintf("%s %s", e.Method, e.URL)
+	if e.Attempt > 1 {
+		msg += fmt.Sprintf(" (attempt %d)", e.Attempt)
+	}
+	if e.Kind == KindStatus {
+		return fmt.Sprintf("%s: unexpected status %d: %s", msg, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+	return target != nil && kindErrors[e.Kind] == target
+}
+
+func (e *RequestError) Timeout() bool {
+	return e.Kind == KindTimeout
+}
+
+// Temporary reports whether retrying may help, see IsRetryableError.
+func (e *RequestError) Temporary() bool {
+	return e.Kind == KindTimeout || e.Kind == KindConnectionRefused || IsRetryableError(e.Err)
+}
+
+func newRequestError(method string, u *url.URL, attempt int, err error) *RequestError {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	return &RequestError{
+		Method:  method,
+		URL:     redactURL(u),
+		Attempt: attempt,
+		Kind:    classifyError(err),
+		Err:     err,
+	}
+}
+
+func classifyError(err error) ErrorKind {
+	if errors.Is(err, context.Canceled) {
+		return KindCanceled
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return KindDNS
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return KindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return KindTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return KindConnectionRefused
+	}
+
+	if isTLSError(err) {
+		return KindTLS
+	}
+	return KindUnknown
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) ||
+		errors.As(err, &invalid) || errors.As(err, &recordHeader) {
+		return true
+	}
+	// alerts and verification failures are not exported types on older Go releases
+	return strings.Contains(err.Error(), "tls: ") || strings.Contains(err.Error(), "x509: ")
+}
@@ -0,0 +1,138 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mjgaga/go_mutils/async"
+)
+
+var (
+	errNoURLs     = errors.New("no urls to request")
+	errNilRequest = errors.New("nil request")
+)
+
+type FanOutRequest struct {
+	Method  string
+	URL     string
+	Body    []byte
+	Headers []*Header
+}
+
+// FanOutResult pairs a request with its outcome, as Do returns it: Err may
+// come with a Response, e.g. when the body could not be read in full.
+type FanOutResult struct {
+	Request  *FanOutRequest
+	Response *Response
+	Err      error
+}
+
+type indexedRequest struct {
+	index   int
+	request *FanOutRequest
+}
+
+// FanOut sends requests on goroutineCount workers, async.StartParallelList
+// style (8 when not given), and returns the results in the order of requests.
+func (client *baseClient) FanOut(ctx context.Context, requests []*FanOutRequest, goroutineCount ...int) []*FanOutResult {
+	initData := make([]interface{}, len(requests))
+	for i, req := range requests {
+		initData[i] = &indexedRequest{index: i, request: req}
+	}
+
+	results := make([]*FanOutResult, len(requests))
+	async.StartParallelList(initData, func(initItem interface{}) interface{} {
+		item := initItem.(*indexedRequest)
+		result := &FanOutResult{Request: item.request}
+		if item.request == nil {
+			result.Err = errNilRequest
+		} else if err := ctx.Err(); err != nil {
+			result.Err = err
+		} else {
+			result.Response, result.Err = client.Do(ctx, item.request.Method, item.request.URL, item.request.Body, item.request.Headers...)
+		}
+		// every index is written by exactly one worker
+		results[item.index] = result
+		return nil
+	}, goroutineCount...)
+
+	return results
+}
+
+func (client *baseClient) GetAll(ctx context.Context, urls []string, goroutineCount int, headers ...*Header) []*FanOutResult {
+	requests := make([]*FanOutRequest, len(urls))
+	for i, url := range urls {
+		requests[i] = &FanOutRequest{Method: http.MethodGet, URL: url, Headers: headers}
+	}
+	return client.FanOut(ctx, requests, goroutineCount)
+}
+
+// GetHedged is DoHedged for GET, e.g. against several mirrors of a resource.
+func (client *baseClient) GetHedged(ctx context.Context, delay time.Duration, urls []string, headers ...*Header) (*Response, error) {
+	return client.DoHedged(ctx, delay, http.MethodGet, urls, nil, headers...)
+}
+
+// DoHedged sends the request to urls[0] and to the next url whenever delay
+// passes or an attempt fails, until one returns a 2xx. The other attempts are
+// canceled. Pass the same url twice to hedge against a single host. When
+// nothing succeeds the last non-2xx response, or else the last error, is returned.
+func (client *baseClient) DoHedged(ctx context.Context, delay time.Duration, method string, urls []string, body []byte, headers ...*Header) (*Response, error) {
+	if len(urls) == 0 {
+		return nil, errNoURLs
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type attempt struct {
+		res *Response
+		err error
+	}
+	attempts := make(chan attempt, len(urls))
+	launched, finished := 0, 0
+	var next <-chan time.Time
+	launch := func() {
+		url := urls[launched]
+		launched++
+		go func() {
+			res, err := client.Do(ctx, method, url, body, headers...)
+			attempts <- attempt{res: res, err: err}
+		}()
+		next = nil
+		if launched < len(urls) {
+			next = time.After(delay)
+		}
+	}
+
+	launch()
+	var lastRes *Response
+	var lastErr error
+	for {
+		select {
+		case a := <-attempts:
+			finished++
+			if a.err == nil && a.res.Is2XX() {
+				return a.res, nil
+			}
+			if a.err == nil {
+				lastRes = a.res
+			} else {
+				lastErr = a.err
+			}
+			if launched < len(urls) {
+				launch()
+			} else if finished == launched {
+				if lastRes != nil {
+					return lastRes, nil
+				}
+				return nil, lastErr
+			}
+		case <-next:
+			launch()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFanOutNilRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	client, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := client.FanOut(context.Background(), []*FanOutRequest{
+		{Method: http.MethodGet, URL: server.URL + "/a"},
+		nil,
+		{Method: http.MethodGet, URL: server.URL + "/c"},
+	})
+
+	if results[1].Err != errNilRequest {
+		t.Fatalf("nil request got %v, want %v", results[1].Err, errNilRequest)
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil {
+			t.Fatal(results[i].Err)
+		}
+		if got, want := string(results[i].Response.Body), results[i].Request.URL[len(server.URL):]; got != want {
+			t.Fatalf("result %d got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// FormFile is one file part of a multipart body. Content is read while the
+// request is being sent and closed afterwards when it is an io.Closer.
+type FormFile struct {
+	Field       string
+	FileName    string
+	ContentType string
+	Content     io.Reader
+}
+
+// OpenFormFile opens path for upload under field.
+func OpenFormFile(field, path string) (*FormFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FormFile{Field: field, FileName: filepath.Base(path), Content: f}, nil
+}
+
+func (client *baseClient) PostForm(ctx context.Context, url string, form url.Values, headers ...*Header) (*Response, error) {
+	return client.Do(ctx, http.MethodPost, url, []byte(form.Encode()), withDefaultHeaders(headers, ContextTypeHeaderForm)...)
+}
+
+// PostFormStruct encodes the exported fields of v, a struct or pointer to
+// struct, using the `form` tag for names. A tag of "-" skips the field.
+func (client *baseClient) PostFormStruct(ctx context.Context, url string, v interface{}, headers ...*Header) (*Response, error) {
+	form, err := StructToValues(v)
+	if err != nil {
+		return nil, err
+	}
+	return client.PostForm(ctx, url, form, headers...)
+}
+
+// PostMultipart streams fields and files as multipart/form-data. The body is
+// produced through an io.Pipe, so it is never buffered and never retried.
+func (client *baseClient) PostMultipart(ctx context.Context, url string, fields url.Values, files []*FormFile, headers ...*Header) (*Response, error) {
+	body, contentType := MultipartBody(fields, files)
+	defer body.Close()
+
+	return client.doResponse(ctx, http.MethodPost, url, body, withDefaultHeaders(headers, &Header{Key: "Content-Type", Value: contentType}))
+}
+
+// MultipartBody returns a reader producing the multipart body and its
+// Content-Type. Closing the reader stops the writer goroutine.
+func MultipartBody(fields url.Values, files []*FormFile) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeMultipart(mw, fields, files))
+	}()
+
+	return pr, mw.FormDataContentType()
+}
+
+func writeMultipart(mw *multipart.Writer, fields url.Values, files []*FormFile) error {
+	defer func() {
+		for _, file := range files {
+			if closer, ok := file.Content.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}()
+
+	for key, values := range fields {
+		for _, value := range values {
+			if err := mw.WriteField(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range files {
+		part, err := mw.CreatePart(file.header())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Content); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+func (file *FormFile) header() map[string][]string {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(file.Field), escapeQuotes(file.FileName))},
+		"Content-Type":        {contentType},
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// StructToValues flattens a struct into url.Values, see PostFormStruct.
+// Slices become repeated keys, nil pointers are skipped and zero values are
+// kept unless the tag says omitempty.
+func StructToValues(v interface{}) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("form: expected a struct, got %T", v)
+	}
+
+	values := url.Values{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, opts := field.Tag.Get("form"), ""
+		if name == "-" {
+			continue
+		}
+		if idx := strings.Index(name, ","); idx >= 0 {
+			name, opts = name[:idx], name[idx+1:]
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		value := rv.Field(i)
+		if opts == "omitempty" && value.IsZero() {
+			continue
+		}
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			values.Add(name, string(value.Bytes()))
+			continue
+		}
+		if value.Kind() == reflect.Slice {
+			for j := 0; j < value.Len(); j++ {
+				values.Add(name, fmt.Sprint(value.Index(j).Interface()))
+			}
+			continue
+		}
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		values.Add(name, fmt.Sprint(value.Interface()))
+	}
+	return values, nil
+}
@@ -0,0 +1,15 @@
+//go:build go1.24
+// +build go1.24
+
+package request
+
+import "net/http"
+
+const h2cSupported = true
+
+func enableH2C(transport *http.Transport) {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	transport.Protocols = protocols
+}
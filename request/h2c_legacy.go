@@ -0,0 +1,12 @@
+//go:build !go1.24
+// +build !go1.24
+
+package request
+
+import "net/http"
+
+// http.Transport learned unencrypted HTTP/2 in Go 1.24, WithH2C reports
+// ErrH2CUnsupported before this is reached.
+const h2cSupported = false
+
+func enableH2C(transport *http.Transport) {}
@@ -0,0 +1,27 @@
+package request
+
+import "errors"
+
+var ErrH2CUnsupported = errors.New("h2c needs a program built with Go 1.24 or later")
+
+// WithHTTP2 negotiates HTTP/2 over TLS through ALPN, falling back to
+// HTTP/1.1 when the server does not offer it. http.Transport only does this
+// on its own when it builds the TLS configuration itself.
+func WithHTTP2() Option {
+	return func(o *options) {
+		o.http2 = true
+	}
+}
+
+// WithH2C speaks HTTP/2 to every server: with prior knowledge and no TLS for
+// http:// URLs, as gRPC-gateway style services expect, and through ALPN for
+// https:// URLs. Servers that only speak HTTP/1.1 fail.
+func WithH2C() Option {
+	return func(o *options) {
+		if !h2cSupported {
+			o.setErr(ErrH2CUnsupported)
+			return
+		}
+		o.h2c = true
+	}
+}
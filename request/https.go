@@ -1,187 +1,78 @@
 package request
 
 import (
-	"bytes"
-	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"io/ioutil"
-	"net/http"
+	"time"
 )
 
 type HttpsClient struct {
-	client http.Client
+	baseClient
 }
 
-func (client *HttpsClient) Head(ctx context.Context, url string, headers ...*Header) (statusCode int, header http.Header, err error) {
-	req, _ := http.NewRequest(http.MethodHead, url, nil)
-	req = req.WithContext(ctx)
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Add(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
-	if err != nil {
-		return 0, nil, err
-	}
-
-	return res.StatusCode, res.Header, err
-}
-
-func (client *HttpsClient) Get(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Add(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
-	if err != nil {
-		return nil, 0, nil, err
-	}
-
-	// if res.TLS != nil {
-	// 	for _, cert := range res.TLS.PeerCertificates {
-	// 	}
-	// }
-
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
-
-}
-
-func (client *HttpsClient) Post(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	bodyReader := bytes.NewReader(body)
-	req, _ := http.NewRequest(http.MethodPost, url, bodyReader)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Set(head.Key, head.Value)
-	}
+func NewHttpsClientWithByte(certBytes []byte, insecureSkipVerify bool) (*HttpsClient, error) {
+	o := legacyOptions()
+	o.caBytes = certBytes
+	o.requireCA = true
+	o.insecureSkipVerify = insecureSkipVerify
 
-	res, err := client.client.Do(req)
+	base, err := newBaseClient(o)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
+	return &HttpsClient{baseClient: base}, nil
 }
 
-func (client *HttpsClient) Patch(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	bodyReader := bytes.NewReader(body)
-	req, _ := http.NewRequest(http.MethodPatch, url, bodyReader)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Set(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
+// NewHttpsClientWithOptions builds an HttpsClient the way New does, e.g. with
+// WithCA and WithPinnedKeys.
+func NewHttpsClientWithOptions(opts ...Option) (*HttpsClient, error) {
+	client, err := New(opts...)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
+	return &HttpsClient{baseClient: client.baseClient}, nil
 }
 
-func (client *HttpsClient) Put(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	bodyReader := bytes.NewReader(body)
-	req, _ := http.NewRequest(http.MethodPut, url, bodyReader)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Set(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
+// NewHttpsClient reads bodies without a size limit like it always has,
+// NewHttpsClientWithOptions applies DefaultMaxBodySize or WithMaxBodySize.
+func NewHttpsClient(caFile string, insecureSkipVerify bool) (*HttpsClient, error) {
+	certBytes, err := ioutil.ReadFile(caFile)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, errors.New("Unable to read cert.pem: " + err.Error())
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
+	return NewHttpsClientWithByte(certBytes, insecureSkipVerify)
 }
 
-func (client *HttpsClient) Delete(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	req, _ := http.NewRequest(http.MethodDelete, url, nil)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Add(head.Key, head.Value)
-	}
+// NewHttpsClientWithCAs trusts the PEM or DER certificates in caPaths, files
+// or directories, on top of the system roots when systemRoots is set.
+func NewHttpsClientWithCAs(caPaths []string, systemRoots, insecureSkipVerify bool) (*HttpsClient, error) {
+	o := legacyOptions()
+	o.caPaths = caPaths
+	o.systemRoots = systemRoots
+	o.insecureSkipVerify = insecureSkipVerify
 
-	res, err := client.client.Do(req)
+	base, err := newBaseClient(o)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
+	return &HttpsClient{baseClient: base}, nil
 }
 
-func NewHttpsClientWithByte(certBytes []byte, insecureSkipVerify bool) (*HttpsClient, error) {
-	clientCertPool := x509.NewCertPool()
-
-	ok := clientCertPool.AppendCertsFromPEM(certBytes)
-	if !ok {
-		return nil, errors.New("failed to parse root certificate")
-	}
-
-	httpClient := &HttpsClient{
-		client: http.Client{
-			// CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// 	return http.ErrUseLastResponse
-			// },
-			Transport: &http.Transport{
-				DisableKeepAlives: true,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: insecureSkipVerify,
-					RootCAs:            clientCertPool,
-				},
-			},
-		},
-	}
-
-	return httpClient, nil
-}
+// NewHttpsClientWithReload is NewHttpsClient re-reading caFile every interval, see WithCertReload.
+func NewHttpsClientWithReload(caFile string, insecureSkipVerify bool, interval time.Duration, onEvent func(CertReloadEvent)) (*HttpsClient, error) {
+	o := legacyOptions()
+	o.caFile = caFile
+	o.insecureSkipVerify = insecureSkipVerify
+	WithCertReload(interval, onEvent)(o)
 
-func NewHttpsClient(caFile string, insecureSkipVerify bool) (*HttpsClient, error) {
-	certBytes, err := ioutil.ReadFile(caFile)
+	base, err := newBaseClient(o)
 	if err != nil {
-		return nil, errors.New("Unable to read cert.pem: " + err.Error())
+		return nil, err
 	}
 
-	return NewHttpsClientWithByte(certBytes, insecureSkipVerify)
+	return &HttpsClient{baseClient: base}, nil
 }
@@ -1,199 +1,170 @@
 package request
 
 import (
-	"bytes"
-	"context"
-	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"io/ioutil"
-	"net/http"
+	"time"
 )
 
 type HttpsClientX509 struct {
-	client http.Client
+	baseClient
 }
 
-func (client *HttpsClientX509) Head(ctx context.Context, url string, headers ...*Header) (statusCode int, header http.Header, err error) {
-	req, _ := http.NewRequest(http.MethodHead, url, nil)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Add(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
+func NewHttpsClientX509WithBytes(caBytes, certBytes, keyData []byte, insecureSkipVerify bool) (*HttpsClientX509, error) {
+	o := legacyOptions()
+	o.caBytes = caBytes
+	o.certBytes = certBytes
+	o.keyBytes = keyData
+	o.requireCA = true
+	o.requireClientCert = true
+	o.insecureSkipVerify = insecureSkipVerify
+
+	base, err := newBaseClient(o)
 	if err != nil {
-		return 0, nil, err
+		return nil, err
 	}
 
-	return res.StatusCode, res.Header, err
+	return &HttpsClientX509{baseClient: base}, nil
 }
 
-func (client *HttpsClientX509) Get(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Add(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
+// NewHttpsClientX509WithOptions builds an HttpsClientX509 the way New does,
+// e.g. with WithClientCertFile and WithTLSProfile.
+func NewHttpsClientX509WithOptions(opts ...Option) (*HttpsClientX509, error) {
+	client, err := New(opts...)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
+	return &HttpsClientX509{baseClient: client.baseClient}, nil
 }
 
-func (client *HttpsClientX509) Post(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	bodyReader := bytes.NewReader(body)
-	req, _ := http.NewRequest(http.MethodPost, url, bodyReader)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Set(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
+// NewHttpsClientX509 reads bodies without a size limit like it always has,
+// NewHttpsClientX509WithOptions applies DefaultMaxBodySize or WithMaxBodySize.
+func NewHttpsClientX509(caFile, certFile, keyFile string, insecureSkipVerify bool) (*HttpsClientX509, error) {
+	certBytes, err := ioutil.ReadFile(caFile)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, errors.New("Unable to read cert.pem: " + err.Error())
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
-}
-
-func (client *HttpsClientX509) Patch(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	bodyReader := bytes.NewReader(body)
-	req, _ := http.NewRequest(http.MethodPatch, url, bodyReader)
-	req = req.WithContext(ctx)
+	clientCertPool := x509.NewCertPool()
+	ok := clientCertPool.AppendCertsFromPEM(certBytes)
 
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Set(head.Key, head.Value)
+	if !ok {
+		return nil, errors.New("failed to parse root certificate")
 	}
 
-	res, err := client.client.Do(req)
+	certPEMBlock, err := ioutil.ReadFile(certFile)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, err
 	}
-
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
-}
-
-func (client *HttpsClientX509) Put(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	bodyReader := bytes.NewReader(body)
-	req, _ := http.NewRequest(http.MethodPut, url, bodyReader)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Set(head.Key, head.Value)
+	keyPEMBlock, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
 	}
+	return NewHttpsClientX509WithBytes(certBytes, certPEMBlock, keyPEMBlock, insecureSkipVerify)
+}
 
-	res, err := client.client.Do(req)
+// NewHttpsClientX509WithReload is NewHttpsClientX509 re-reading the three
+// files every interval, see WithCertReload.
+func NewHttpsClientX509WithReload(caFile, certFile, keyFile string, insecureSkipVerify bool, interval time.Duration, onEvent func(CertReloadEvent)) (*HttpsClientX509, error) {
+	o := legacyOptions()
+	o.caFile = caFile
+	o.certFile = certFile
+	o.keyFile = keyFile
+	o.insecureSkipVerify = insecureSkipVerify
+	WithCertReload(interval, onEvent)(o)
+
+	base, err := newBaseClient(o)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
+	return &HttpsClientX509{baseClient: base}, nil
 }
 
-func (client *HttpsClientX509) Delete(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error) {
-	req, _ := http.NewRequest(http.MethodDelete, url, nil)
-	req = req.WithContext(ctx)
-
-	for _, head := range headers {
-		if head == nil {
-			continue
-		}
-		req.Header.Add(head.Key, head.Value)
-	}
-
-	res, err := client.client.Do(req)
+// NewHttpsClientX509WithPasswordBytes is NewHttpsClientX509WithBytes for a
+// passphrase protected key, see X509KeyPairWithPassword.
+func NewHttpsClientX509WithPasswordBytes(caBytes, certBytes, keyData []byte, password string, insecureSkipVerify bool) (*HttpsClientX509, error) {
+	o := legacyOptions()
+	o.caBytes = caBytes
+	o.certBytes = certBytes
+	o.keyBytes = keyData
+	o.requireCA = true
+	o.requireClientCert = true
+	o.keyPassword = password
+	o.insecureSkipVerify = insecureSkipVerify
+
+	base, err := newBaseClient(o)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-
-	return data, res.StatusCode, res.Header, err
+	return &HttpsClientX509{baseClient: base}, nil
 }
 
-func NewHttpsClientX509WithBytes(caBytes, certBytes, keyData []byte, insecureSkipVerify bool) (*HttpsClientX509, error) {
-	clientCertPool := x509.NewCertPool()
-	if ok := clientCertPool.AppendCertsFromPEM(caBytes); !ok {
-		return nil, errors.New("failed to parse root certificate")
+func NewHttpsClientX509WithPassword(caFile, certFile, keyFile, password string, insecureSkipVerify bool) (*HttpsClientX509, error) {
+	caBytes, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.New("Unable to read cert.pem: " + err.Error())
+	}
+	certPEMBlock, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
 	}
-	cert, err := tls.X509KeyPair(certBytes, keyData)
+	keyPEMBlock, err := ioutil.ReadFile(keyFile)
 	if err != nil {
 		return nil, err
 	}
-	httpClient := &HttpsClientX509{
-		client: http.Client{
-			// CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// 	return http.ErrUseLastResponse
-			// },
-			Transport: &http.Transport{
-				DisableKeepAlives: true,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: insecureSkipVerify,
-					RootCAs:            clientCertPool,
-					Certificates:       []tls.Certificate{cert},
-				},
-			},
-		},
-	}
-
-	return httpClient, nil
+	return NewHttpsClientX509WithPasswordBytes(caBytes, certPEMBlock, keyPEMBlock, password, insecureSkipVerify)
 }
 
-func NewHttpsClientX509(caFile, certFile, keyFile string, insecureSkipVerify bool) (*HttpsClientX509, error) {
-	certBytes, err := ioutil.ReadFile(caFile)
+var errNoPKCS12CA = errors.New("pkcs12: bundle holds no CA certificates to verify servers with")
+
+// NewHttpsClientX509PKCS12WithBytes presents the certificate and chain of a
+// .p12/.pfx bundle. Servers are verified with caBytes, or with the bundle's
+// CA certificates when caBytes is nil; it fails when neither holds one, rather
+// than trusting the system roots, unless insecureSkipVerify is set.
+func NewHttpsClientX509PKCS12WithBytes(caBytes, pfxData []byte, password string, insecureSkipVerify bool) (*HttpsClientX509, error) {
+	cert, caCerts, err := DecodePKCS12(pfxData, password)
 	if err != nil {
-		return nil, errors.New("Unable to read cert.pem: " + err.Error())
+		return nil, err
 	}
 
-	clientCertPool := x509.NewCertPool()
-	ok := clientCertPool.AppendCertsFromPEM(certBytes)
+	if caBytes == nil && len(caCerts) == 0 && !insecureSkipVerify {
+		return nil, errNoPKCS12CA
+	}
 
-	if !ok {
-		return nil, errors.New("failed to parse root certificate")
+	o := legacyOptions()
+	o.caBytes = caBytes
+	if caBytes == nil {
+		o.rootCAs = caCerts
 	}
+	o.clientCert = &cert
+	o.insecureSkipVerify = insecureSkipVerify
 
-	certPEMBlock, err := ioutil.ReadFile(certFile)
+	base, err := newBaseClient(o)
 	if err != nil {
 		return nil, err
 	}
-	keyPEMBlock, err := ioutil.ReadFile(keyFile)
+
+	return &HttpsClientX509{baseClient: base}, nil
+}
+
+// NewHttpsClientX509PKCS12 reads the bundle from pfxFile, an empty caFile
+// trusts the bundle's CA certificates.
+func NewHttpsClientX509PKCS12(caFile, pfxFile, password string, insecureSkipVerify bool) (*HttpsClientX509, error) {
+	var caBytes []byte
+	if caFile != "" {
+		b, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.New("Unable to read cert.pem: " + err.Error())
+		}
+		caBytes = b
+	}
+	pfxData, err := ioutil.ReadFile(pfxFile)
 	if err != nil {
 		return nil, err
 	}
-	return NewHttpsClientX509WithBytes(certBytes, certPEMBlock, keyPEMBlock, insecureSkipVerify)
+	return NewHttpsClientX509PKCS12WithBytes(caBytes, pfxData, password, insecureSkipVerify)
 }
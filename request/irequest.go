@@ -1,31 +1,34 @@
 package request
 
-import "time"
+import (
+	"context"
+	"net/http"
+	"time"
+)
 
 var (
 	ContextTypeHeaderJson = &Header{Key: "Content-Type", Value: "application/json"}
 	ContextTypeHeaderForm = &Header{Key: "Content-Type", Value: "application/x-www-form-urlencoded"}
+	AcceptHeaderJson      = &Header{Key: "Accept", Value: "application/json"}
 )
 
 const DefaultTimeout = time.Second * 10
 
-//type Request interface {
-//	Get(url string, ch chan *Result, headers ...*Header)
-//	Post(url string, body string, ch chan *Result, headers ...*Header)
-//	//Put(url string, body string, ch chan *Result, headers ...*Header)
-//	Patch(url string, body string, ch chan *Result, headers ...*Header)
-//	Delete(url string, ch chan *Result, headers ...*Header)
-//}
-//
-//type Result struct {
-//	Result     []byte
-//	Error      error
-//	StatusCode int
-//}
-//
-//func (r *Result) Is2XX() bool {
-//	return r.StatusCode >= http.StatusOK && r.StatusCode <= http.StatusIMUsed
-//}
+// Client is satisfied by HttpClient, HttpsClient and HttpsClientX509.
+type Client interface {
+	Head(ctx context.Context, url string, headers ...*Header) (statusCode int, header http.Header, err error)
+	Get(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error)
+	Post(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error)
+	Patch(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error)
+	Put(ctx context.Context, url string, body []byte, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error)
+	Delete(ctx context.Context, url string, headers ...*Header) (resBody []byte, statusCode int, header http.Header, err error)
+}
+
+var (
+	_ Client = (*HttpClient)(nil)
+	_ Client = (*HttpsClient)(nil)
+	_ Client = (*HttpsClientX509)(nil)
+)
 
 type Header struct {
 	Key   string
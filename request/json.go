@@ -0,0 +1,90 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// WithJSONError makes the JSON helpers decode non-2xx bodies into the error
+// returned by newErr, e.g. func() error { return &ApiError{} }. When the body
+// does not decode, the helpers fall back to a *StatusError.
+func WithJSONError(newErr func() error) Option {
+	return func(o *options) {
+		o.jsonError = newErr
+	}
+}
+
+func (client *baseClient) GetJSON(ctx context.Context, url string, out interface{}, headers ...*Header) error {
+	return client.doJSON(ctx, http.MethodGet, url, nil, out, headers)
+}
+
+func (client *baseClient) PostJSON(ctx context.Context, url string, in, out interface{}, headers ...*Header) error {
+	return client.doJSON(ctx, http.MethodPost, url, in, out, headers)
+}
+
+func (client *baseClient) PutJSON(ctx context.Context, url string, in, out interface{}, headers ...*Header) error {
+	return client.doJSON(ctx, http.MethodPut, url, in, out, headers)
+}
+
+func (client *baseClient) PatchJSON(ctx context.Context, url string, in, out interface{}, headers ...*Header) error {
+	return client.doJSON(ctx, http.MethodPatch, url, in, out, headers)
+}
+
+func (client *baseClient) DeleteJSON(ctx context.Context, url string, out interface{}, headers ...*Header) error {
+	return client.doJSON(ctx, http.MethodDelete, url, nil, out, headers)
+}
+
+func (client *baseClient) doJSON(ctx context.Context, method, url string, in, out interface{}, headers []*Header) error {
+	var body []byte
+	defaults := []*Header{AcceptHeaderJson}
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+		defaults = append(defaults, ContextTypeHeaderJson)
+	}
+
+	res, err := client.Do(ctx, method, url, body, withDefaultHeaders(headers, defaults...)...)
+	if err != nil {
+		return err
+	}
+
+	if !res.Is2XX() {
+		if client.jsonError != nil && len(res.Body) > 0 {
+			apiErr := client.jsonError()
+			if json.Unmarshal(res.Body, apiErr) == nil {
+				return apiErr
+			}
+		}
+		return res.EnsureSuccess()
+	}
+
+	if out == nil || len(res.Body) == 0 {
+		return nil
+	}
+	return res.JSON(out)
+}
+
+// withDefaultHeaders puts defaults in front of headers unless headers already set the same key.
+func withDefaultHeaders(headers []*Header, defaults ...*Header) []*Header {
+	merged := make([]*Header, 0, len(headers)+len(defaults))
+	for _, def := range defaults {
+		if !hasHeader(headers, def.Key) {
+			merged = append(merged, def)
+		}
+	}
+	return append(merged, headers...)
+}
+
+func hasHeader(headers []*Header, key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	for _, head := range headers {
+		if head != nil && http.CanonicalHeaderKey(head.Key) == key {
+			return true
+		}
+	}
+	return false
+}
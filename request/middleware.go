@@ -0,0 +1,151 @@
+package request
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Middleware wraps the round tripper below it. Middlewares run once per
+// attempt and per redirect hop, the first one registered being the outermost.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+func chainMiddlewares(transport http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			transport = middlewares[i](transport)
+		}
+	}
+	return transport
+}
+
+// SetHeaders sets headers on every request, replacing values of the same key.
+func SetHeaders(headers ...*Header) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for _, head := range headers {
+				if head == nil {
+					continue
+				}
+				req.Header.Set(head.Key, head.Value)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func UserAgent(userAgent string) Middleware {
+	return SetHeaders(&Header{Key: "User-Agent", Value: userAgent})
+}
+
+// RequestID sets header to a random id unless the request already carries one.
+func RequestID(header string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(header, newRequestID())
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Logging reports method, URL, status and duration of every round trip
+// through logf, e.g. log.Printf.
+func Logging(logf func(format string, args ...interface{})) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				logf("%s %s failed after %s: %v", req.Method, redactURL(req.URL), time.Since(start), err)
+				return res, err
+			}
+			logf("%s %s %d %s", req.Method, redactURL(req.URL), res.StatusCode, time.Since(start))
+			return res, err
+		})
+	}
+}
+
+// Metrics calls observe after every round trip. res is nil when err is not.
+func Metrics(observe func(req *http.Request, res *http.Response, err error, elapsed time.Duration)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			observe(req, res, err, time.Since(start))
+			return res, err
+		})
+	}
+}
+
+// SignRequest lets sign add signatures or credentials to a copy of each
+// request. An error from sign aborts the request.
+func SignRequest(sign func(req *http.Request) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			if err := sign(req); err != nil {
+				closeRequestBody(req)
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// ValidateResponse turns responses rejected by validate into errors.
+// The rejected response body is closed.
+func ValidateResponse(validate func(res *http.Response) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				return res, err
+			}
+			if err := validate(res); err != nil {
+				res.Body.Close()
+				return nil, err
+			}
+			return res, nil
+		})
+	}
+}
+
+func redactURL(u *url.URL) string {
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return redacted.String()
+}
+
+// closeRequestBody honours the RoundTripper contract of always closing the body.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
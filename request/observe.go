@@ -0,0 +1,325 @@
+package request
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracer starts a span for each logical request, covering every retry and
+// redirect until the response body has been read or closed. Adapters for
+// OpenTelemetry and the like implement it; NewW3CTracer is a dependency free one.
+type Tracer interface {
+	Start(ctx context.Context, req *http.Request) (context.Context, Span)
+}
+
+type Span interface {
+	// SpanContext is sent to the server as the traceparent and tracestate
+	// headers; an invalid SpanContext sends nothing.
+	SpanContext() SpanContext
+	End(info RequestInfo)
+}
+
+// MetricsRecorder receives one observation per logical request, for
+// duration histograms and status, retry and byte counters.
+type MetricsRecorder interface {
+	Observe(info RequestInfo)
+}
+
+type MetricsRecorderFunc func(info RequestInfo)
+
+func (f MetricsRecorderFunc) Observe(info RequestInfo) {
+	f(info)
+}
+
+// RequestInfo describes a finished logical request.
+type RequestInfo struct {
+	Method string
+	// URL has any password redacted.
+	URL        string
+	Host       string
+	StatusCode int
+	Proto      string
+	Attempts   int
+	// BytesOut counts request body bytes over all attempts, BytesIn the
+	// response body bytes read by the caller.
+	BytesOut int64
+	BytesIn  int64
+	// Duration runs from sending the request until the body was read or closed.
+	Duration time.Duration
+	// Timing is nil unless the client was built with WithTiming.
+	Timing *Timing
+	Err    error
+}
+
+// StatusClass is "2xx", "4xx" and so on, or "error" when no response arrived.
+func (info *RequestInfo) StatusClass() string {
+	if info.StatusCode < 100 || info.StatusCode > 599 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", info.StatusCode/100)
+}
+
+func (info *RequestInfo) Retries() int {
+	if info.Attempts < 1 {
+		return 0
+	}
+	return info.Attempts - 1
+}
+
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+func WithMetricsRecorder(recorder MetricsRecorder) Option {
+	return func(o *options) {
+		o.metrics = recorder
+	}
+}
+
+// SpanContext identifies a span as W3C Trace Context does.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+var errInvalidTraceParent = errors.New("invalid traceparent")
+
+// ParseTraceParent reads a traceparent header value, e.g. to continue the
+// trace of an incoming request with ContextWithSpanContext.
+func ParseTraceParent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errInvalidTraceParent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errInvalidTraceParent
+	}
+	for _, part := range parts[:4] {
+		if strings.ToLower(part) != part {
+			return sc, errInvalidTraceParent
+		}
+	}
+
+	version, err1 := hex.DecodeString(parts[0])
+	_, err2 := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, err3 := hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	flags, err4 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || len(version) != 1 || !sc.IsValid() {
+		return SpanContext{}, errInvalidTraceParent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext makes sc the parent of spans started by NewW3CTracer.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// NewW3CTracer continues the trace found with SpanContextFromContext or
+// starts a sampled one, and calls onEnd with each finished span. onEnd may
+// be nil when only propagation is wanted.
+func NewW3CTracer(onEnd func(span, parent SpanContext, info RequestInfo)) Tracer {
+	return &w3cTracer{onEnd: onEnd}
+}
+
+type w3cTracer struct {
+	onEnd func(span, parent SpanContext, info RequestInfo)
+}
+
+func (t *w3cTracer) Start(ctx context.Context, req *http.Request) (context.Context, Span) {
+	parent, ok := SpanContextFromContext(ctx)
+	span := &w3cSpan{tracer: t, parent: parent, sc: SpanContext{Sampled: true}}
+	if ok {
+		span.sc.TraceID, span.sc.Sampled, span.sc.TraceState = parent.TraceID, parent.Sampled, parent.TraceState
+	} else {
+		rand.Read(span.sc.TraceID[:])
+	}
+	rand.Read(span.sc.SpanID[:])
+	return ContextWithSpanContext(ctx, span.sc), span
+}
+
+type w3cSpan struct {
+	tracer *w3cTracer
+	parent SpanContext
+	sc     SpanContext
+}
+
+func (s *w3cSpan) SpanContext() SpanContext {
+	return s.sc
+}
+
+func (s *w3cSpan) End(info RequestInfo) {
+	if s.tracer.onEnd != nil {
+		s.tracer.onEnd(s.sc, s.parent, info)
+	}
+}
+
+// observation follows one logical request for the tracer, metrics and timing.
+type observation struct {
+	span     Span
+	metrics  MetricsRecorder
+	trace    *timingTrace
+	onTiming func(info RequestInfo)
+	info     RequestInfo
+	start    time.Time
+	bytesOut int64
+	bytesIn  int64
+	once     sync.Once
+}
+
+// observe starts the span and the timing trace and counts the request body,
+// it returns nil when the client has no tracer, metrics or timing.
+func (client *baseClient) observe(req *http.Request) (*http.Request, *observation) {
+	if client.tracer == nil && client.metrics == nil && !client.timing {
+		return req, nil
+	}
+
+	obs := &observation{
+		metrics:  client.metrics,
+		onTiming: client.onTiming,
+		info: RequestInfo{
+			Method: req.Method,
+			URL:    redactURL(req.URL),
+			Host:   req.URL.Host,
+		},
+		start: time.Now(),
+	}
+
+	if client.tracer != nil {
+		ctx, span := client.tracer.Start(req.Context(), req)
+		obs.span = span
+		req = req.WithContext(ctx)
+		if sc := span.SpanContext(); sc.IsValid() {
+			req.Header.Set("traceparent", sc.TraceParent())
+			if sc.TraceState != "" {
+				req.Header.Set("tracestate", sc.TraceState)
+			}
+		}
+	}
+
+	if client.timing {
+		obs.trace = &timingTrace{}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), obs.trace.clientTrace()))
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingBody{ReadCloser: req.Body, n: &obs.bytesOut}
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return &countingBody{ReadCloser: body, n: &obs.bytesOut}, nil
+			}
+		}
+	}
+	return req, obs
+}
+
+// response finishes the observation once res.Body is drained or closed, or
+// right away when there is no response.
+func (obs *observation) response(res *http.Response, attempts int, err error) *http.Response {
+	if obs == nil {
+		return res
+	}
+	obs.info.Attempts = attempts
+	if res == nil {
+		obs.finish(err)
+		return res
+	}
+
+	obs.info.StatusCode = res.StatusCode
+	obs.info.Proto = res.Proto
+	res.Body = &observedBody{countingBody: countingBody{ReadCloser: res.Body, n: &obs.bytesIn}, obs: obs}
+	return res
+}
+
+func (obs *observation) finish(err error) {
+	obs.once.Do(func() {
+		obs.info.Duration = time.Since(obs.start)
+		obs.info.BytesOut = atomic.LoadInt64(&obs.bytesOut)
+		obs.info.BytesIn = atomic.LoadInt64(&obs.bytesIn)
+		obs.info.Err = err
+		if obs.trace != nil {
+			obs.info.Timing = obs.trace.finish()
+		}
+		if obs.span != nil {
+			obs.span.End(obs.info)
+		}
+		if obs.metrics != nil {
+			obs.metrics.Observe(obs.info)
+		}
+		if obs.onTiming != nil {
+			obs.onTiming(obs.info)
+		}
+	})
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(b.n, int64(n))
+	return n, err
+}
+
+type observedBody struct {
+	countingBody
+	obs *observation
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.countingBody.Read(p)
+	if err == io.EOF {
+		b.obs.finish(nil)
+	} else if err != nil {
+		b.obs.finish(err)
+	}
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	err := b.countingBody.Close()
+	b.obs.finish(nil)
+	return err
+}
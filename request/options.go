@@ -0,0 +1,287 @@
+package request
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 10
+	DefaultIdleConnTimeout     = time.Second * 90
+	DefaultTLSHandshakeTimeout = time.Second * 10
+)
+
+type Option func(*options)
+
+type options struct {
+	timeout             time.Duration
+	keepAlive           bool
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	tlsHandshakeTimeout time.Duration
+	maxBodySize         int64
+	http2               bool
+	h2c                 bool
+
+	insecureSkipVerify bool
+	caFile             string
+	caPaths            []string
+	caBytes            []byte
+	systemRoots        bool
+	certFile           string
+	keyFile            string
+	certBytes          []byte
+	keyBytes           []byte
+	keyPassword        string
+	clientCert         *tls.Certificate
+	rootCAs            []*x509.Certificate
+	certReload         *certReloadSettings
+	peer               peerVerification
+	tls                tlsSettings
+	// reloader is created by tlsConfig when certReload is set
+	reloader *certReloader
+	// the legacy constructors fail on missing CA or key pair material
+	// instead of falling back to the system roots or no client certificate
+	requireCA         bool
+	requireClientCert bool
+
+	retry       *RetryPolicy
+	redirect    *RedirectPolicy
+	jsonError   func() error
+	tracer      Tracer
+	metrics     MetricsRecorder
+	timing      bool
+	onTiming    func(info RequestInfo)
+	middlewares []Middleware
+	proxy       func(req *http.Request) (*url.URL, error)
+	// roundTripper replaces the transport built from the options above
+	roundTripper http.RoundTripper
+
+	// err keeps the first invalid option, New reports it
+	err error
+}
+
+func (o *options) setErr(err error) {
+	if o.err == nil {
+		o.err = err
+	}
+}
+
+func defaultOptions() *options {
+	return &options{
+		timeout:             DefaultTimeout,
+		keepAlive:           true,
+		maxIdleConns:        DefaultMaxIdleConns,
+		maxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		idleConnTimeout:     DefaultIdleConnTimeout,
+		tlsHandshakeTimeout: DefaultTLSHandshakeTimeout,
+		maxBodySize:         DefaultMaxBodySize,
+	}
+}
+
+// legacyOptions reproduces what NewHttpClient, NewHttpsClient and
+// NewHttpsClientX509 have always built: no keep-alive and no overall timeout.
+func legacyOptions() *options {
+	return &options{keepAlive: false}
+}
+
+// WithTimeout bounds the whole exchange, including reading the body. Zero means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+func WithKeepAlive(keepAlive bool) Option {
+	return func(o *options) {
+		o.keepAlive = keepAlive
+	}
+}
+
+func WithMaxIdleConns(total, perHost int) Option {
+	return func(o *options) {
+		o.maxIdleConns = total
+		o.maxIdleConnsPerHost = perHost
+	}
+}
+
+func WithMaxConnsPerHost(max int) Option {
+	return func(o *options) {
+		o.maxConnsPerHost = max
+	}
+}
+
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleConnTimeout = timeout
+	}
+}
+
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.tlsHandshakeTimeout = timeout
+	}
+}
+
+func WithInsecureSkipVerify(insecureSkipVerify bool) Option {
+	return func(o *options) {
+		o.insecureSkipVerify = insecureSkipVerify
+	}
+}
+
+func WithCAFile(caFile string) Option {
+	return func(o *options) {
+		o.caFile = caFile
+	}
+}
+
+func WithCA(caBytes []byte) Option {
+	return func(o *options) {
+		o.caBytes = caBytes
+	}
+}
+
+func WithClientCertFile(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+func WithClientCert(certBytes, keyBytes []byte) Option {
+	return func(o *options) {
+		o.certBytes = certBytes
+		o.keyBytes = keyBytes
+	}
+}
+
+// WithKeyPassword decrypts the key given to WithClientCert or
+// WithClientCertFile, see X509KeyPairWithPassword.
+func WithKeyPassword(password string) Option {
+	return func(o *options) {
+		o.keyPassword = password
+	}
+}
+
+// WithClientCertificate presents cert, e.g. one returned by DecodePKCS12.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(o *options) {
+		o.clientCert = &cert
+	}
+}
+
+// WithClientCertPKCS12 presents the certificate and key of a .p12/.pfx
+// bundle. The bundle's CA certificates are not trusted, pass them to
+// WithRootCAs for that.
+func WithClientCertPKCS12(pfxData []byte, password string) Option {
+	return func(o *options) {
+		cert, _, err := DecodePKCS12(pfxData, password)
+		if err != nil {
+			o.setErr(err)
+			return
+		}
+		o.clientCert = &cert
+	}
+}
+
+// WithRootCAs trusts certs in addition to WithCA and WithCAFile.
+func WithRootCAs(certs ...*x509.Certificate) Option {
+	return func(o *options) {
+		o.rootCAs = append(o.rootCAs, certs...)
+	}
+}
+
+// WithTransport replaces the network transport, e.g. with a
+// requesttest.Transport. Connection and TLS options have no effect then,
+// middlewares still wrap it.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.roundTripper = transport
+	}
+}
+
+// New builds a client from opts. Without options it keeps connections alive
+// and applies DefaultTimeout; the TLS options make it usable for https and
+// mutual TLS just like HttpsClient and HttpsClientX509.
+func New(opts ...Option) (*HttpClient, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+
+	base, err := newBaseClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HttpClient{baseClient: base}, nil
+}
+
+func newBaseClient(o *options) (baseClient, error) {
+	if o.err != nil {
+		return baseClient{}, o.err
+	}
+
+	tlsConfig, err := o.tlsConfig()
+	if err != nil {
+		return baseClient{}, err
+	}
+
+	return buildBaseClient(o, tlsConfig), nil
+}
+
+func buildBaseClient(o *options, tlsConfig *tls.Config) baseClient {
+	var checkRedirect func(req *http.Request, via []*http.Request) error
+	if o.redirect != nil {
+		checkRedirect = o.redirect.checkRedirect
+	}
+
+	return baseClient{
+		client: http.Client{
+			CheckRedirect: checkRedirect,
+			Timeout:       o.timeout,
+			Transport:     chainMiddlewares(o.baseTransport(tlsConfig), o.middlewares),
+		},
+		retry:       o.retry,
+		maxBodySize: o.maxBodySize,
+		jsonError:   o.jsonError,
+		reloader:    o.reloader,
+		tracer:      o.tracer,
+		metrics:     o.metrics,
+		timing:      o.timing,
+		onTiming:    o.onTiming,
+	}
+}
+
+func (o *options) baseTransport(tlsConfig *tls.Config) http.RoundTripper {
+	if o.roundTripper != nil {
+		return o.roundTripper
+	}
+	return o.transport(tlsConfig)
+}
+
+func (o *options) transport(tlsConfig *tls.Config) *http.Transport {
+	transport := &http.Transport{
+		Proxy:               o.proxy,
+		DisableKeepAlives:   !o.keepAlive,
+		MaxIdleConns:        o.maxIdleConns,
+		MaxIdleConnsPerHost: o.maxIdleConnsPerHost,
+		MaxConnsPerHost:     o.maxConnsPerHost,
+		IdleConnTimeout:     o.idleConnTimeout,
+		TLSHandshakeTimeout: o.tlsHandshakeTimeout,
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   o.http2 || o.tls.offersHTTP2(),
+	}
+	if o.h2c {
+		enableH2C(transport)
+	}
+	return transport
+}
@@ -0,0 +1,326 @@
+package request
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+)
+
+var ErrIncorrectPassword = errors.New("decryption password incorrect")
+
+var (
+	oidPBES2                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidPBEWithSHAAnd3KeyDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHAAnd2KeyDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 4}
+	oidPBEWithSHAAnd128BitRC2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}
+	oidPBEWithSHAAnd40BitRC2   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3   = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// X509KeyPairWithPassword is tls.X509KeyPair for a key that may be
+// encrypted, either as "ENCRYPTED PRIVATE KEY" (PKCS#8) or as a legacy
+// OpenSSL PEM with a DEK-Info header. Unencrypted keys ignore password.
+func X509KeyPairWithPassword(certPEM, keyPEM []byte, password string) (tls.Certificate, error) {
+	if password == "" {
+		return tls.X509KeyPair(certPEM, keyPEM)
+	}
+
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			// nothing encrypted, let X509KeyPair report what is wrong
+			return tls.X509KeyPair(certPEM, keyPEM)
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			der, err := decryptPKCS8(block.Bytes, password)
+			if err != nil {
+				return tls.Certificate{}, err
+			}
+			return tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		case x509.IsEncryptedPEMBlock(block):
+			der, err := x509.DecryptPEMBlock(block, []byte(password))
+			if err != nil {
+				if err == x509.IncorrectPasswordError {
+					err = ErrIncorrectPassword
+				}
+				return tls.Certificate{}, err
+			}
+			return tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}))
+		}
+	}
+}
+
+// decryptPKCS8 returns the DER PrivateKeyInfo inside an EncryptedPrivateKeyInfo.
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshalDER(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+	return pbeDecrypt(info.Algorithm, info.EncryptedData, password)
+}
+
+// pbeDecrypt supports PBES2 with PBKDF2 and AES or 3DES, and the PKCS#12
+// SHA-1 3DES and RC2 schemes, RC2 being what old exports use for certificates.
+func pbeDecrypt(alg pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	var err error
+
+	switch {
+	case alg.Algorithm.Equal(oidPBES2):
+		block, iv, err = pbes2Cipher(alg.Parameters.FullBytes, password)
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3KeyDESCBC), alg.Algorithm.Equal(oidPBEWithSHAAnd2KeyDESCBC),
+		alg.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2), alg.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2):
+		block, iv, err = pkcs12PBECipher(alg, password)
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm %v", alg.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted data is not a multiple of the block size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// a wrong password nearly always shows up as broken padding
+	n := int(out[len(out)-1])
+	if n == 0 || n > block.BlockSize() || !bytes.Equal(out[len(out)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrIncorrectPassword
+	}
+	return out[:len(out)-n], nil
+}
+
+func pbes2Cipher(params []byte, password string) (cipher.Block, []byte, error) {
+	var p pbes2Params
+	if err := unmarshalDER(params, &p); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBES2 parameters: %v", err)
+	}
+	if !p.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("unsupported key derivation function %v", p.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if err := unmarshalDER(p.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBKDF2 parameters: %v", err)
+	}
+
+	prf := sha1.New
+	switch alg := kdf.PRF.Algorithm; {
+	case len(alg) == 0, alg.Equal(oidHMACWithSHA1):
+	case alg.Equal(oidHMACWithSHA224):
+		prf = sha256.New224
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case alg.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, nil, fmt.Errorf("unsupported PBKDF2 PRF %v", alg)
+	}
+
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch alg := p.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case alg.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case alg.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case alg.Equal(oidDESEDE3):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, nil, fmt.Errorf("unsupported encryption scheme %v", alg)
+	}
+
+	var iv []byte
+	if err := unmarshalDER(p.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("invalid encryption scheme IV: %v", err)
+	}
+	if kdf.Iterations <= 0 {
+		return nil, nil, errors.New("invalid PBKDF2 iteration count")
+	}
+
+	block, err := newCipher(pbkdf2Key(prf, []byte(password), kdf.Salt, kdf.Iterations, keyLen))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, nil, errors.New("invalid encryption scheme IV length")
+	}
+	return block, iv, nil
+}
+
+func pkcs12PBECipher(alg pkix.AlgorithmIdentifier, password string) (cipher.Block, []byte, error) {
+	var p pbeParams
+	if err := unmarshalDER(alg.Parameters.FullBytes, &p); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBE parameters: %v", err)
+	}
+	if p.Iterations <= 0 {
+		return nil, nil, errors.New("invalid PBE iteration count")
+	}
+
+	pass := bmpString(password)
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch {
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3KeyDESCBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd2KeyDESCBC):
+		keyLen, newCipher = 16, func(key []byte) (cipher.Block, error) {
+			return des.NewTripleDESCipher(append(key, key[:8]...))
+		}
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2):
+		keyLen, newCipher = 16, func(key []byte) (cipher.Block, error) { return newRC2Cipher(key, 128) }
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2):
+		keyLen, newCipher = 5, func(key []byte) (cipher.Block, error) { return newRC2Cipher(key, 40) }
+	default:
+		return nil, nil, fmt.Errorf("unsupported encryption algorithm %v", alg.Algorithm)
+	}
+
+	block, err := newCipher(pkcs12KDF(sha1.New, 64, pass, p.Salt, p.Iterations, 1, keyLen))
+	if err != nil {
+		return nil, nil, err
+	}
+	iv := pkcs12KDF(sha1.New, 64, pass, p.Salt, p.Iterations, 2, block.BlockSize())
+	return block, iv, nil
+}
+
+// pbkdf2Key is PBKDF2 from RFC 8018.
+func pbkdf2Key(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	dk := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for i := 1; i <= blocks; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(i))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+// pkcs12KDF derives size bytes of key material (id 1), IV (id 2) or MAC
+// key (id 3) as described in RFC 7292 appendix B. v is the hash block size.
+func pkcs12KDF(h func() hash.Hash, v int, password, salt []byte, iterations int, id byte, size int) []byte {
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	d := bytes.Repeat([]byte{id}, v)
+	in := append(fill(salt), fill(password)...)
+
+	var out []byte
+	for len(out) < size {
+		hh := h()
+		hh.Write(d)
+		hh.Write(in)
+		a := hh.Sum(nil)
+		for n := 1; n < iterations; n++ {
+			hh.Reset()
+			hh.Write(a)
+			a = hh.Sum(a[:0])
+		}
+		out = append(out, a...)
+
+		// I_j = (I_j + B + 1) mod 2^(v*8) for every v byte block of I
+		b := fill(a)[:v]
+		for j := 0; j < len(in); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(in[j+k]) + int(b[k]) + carry
+				in[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// bmpString is the null terminated UTF-16BE password PKCS#12 hashes.
+func bmpString(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2*len(units)+2)
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return append(out, 0, 0)
+}
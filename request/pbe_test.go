@@ -0,0 +1,117 @@
+package request
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testPassword = "s3cret"
+
+func readTestdata(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "pkcs12", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// RFC 6070 test vectors for PBKDF2-HMAC-SHA1.
+func TestPBKDF2RFC6070(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"password", "salt", 16777216, 20, "eefe3d61cd4da4e4e9945b3d6ba2158c2634e984"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{"pass\x00word", "sa\x00lt", 4096, 16, "56fa6aa75548099dcc37d7f03425e0c3"},
+	}
+
+	for _, tt := range tests {
+		if tt.iterations > 100000 && testing.Short() {
+			continue
+		}
+		got := hex.EncodeToString(pbkdf2Key(sha1.New, []byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("PBKDF2(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestBMPString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []byte
+	}{
+		{"", []byte{0, 0}},
+		{"ab", []byte{0, 'a', 0, 'b', 0, 0}},
+		{"é😀", []byte{0x00, 0xe9, 0xd8, 0x3d, 0xde, 0x00, 0, 0}},
+	}
+	for _, tt := range tests {
+		if got := bmpString(tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("bmpString(%q) = %x, want %x", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestX509KeyPairWithPassword(t *testing.T) {
+	certPEM := readTestdata(t, "client.pem")
+	block, _ := pem.Decode(certPEM)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		keyFile  string
+		password string
+		wantErr  error
+	}{
+		{"PBES2 AES-128 HMAC-SHA512", "client.pbes2.key", testPassword, nil},
+		{"PKCS#12 PBE SHA1 3DES", "client.3des.key", testPassword, nil},
+		{"legacy DEK-Info AES-256", "client.legacy.key", testPassword, nil},
+		{"unencrypted ignores password", "client.key", testPassword, nil},
+		{"unencrypted without password", "client.key", "", nil},
+		{"PBES2 wrong password", "client.pbes2.key", "wrong", ErrIncorrectPassword},
+		{"PBE 3DES wrong password", "client.3des.key", "wrong", ErrIncorrectPassword},
+		{"legacy wrong password", "client.legacy.key", "wrong", ErrIncorrectPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := X509KeyPairWithPassword(certPEM, readTestdata(t, tt.keyFile), tt.password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer := cert.PrivateKey.(crypto.Signer)
+			if !signer.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(leaf.PublicKey) {
+				t.Fatal("private key does not match the certificate")
+			}
+		})
+	}
+}
+
+func TestX509KeyPairWithPasswordMissingPassword(t *testing.T) {
+	if _, err := X509KeyPairWithPassword(readTestdata(t, "client.pem"), readTestdata(t, "client.pbes2.key"), ""); err == nil {
+		t.Fatal("expected an error for an encrypted key without password")
+	}
+}
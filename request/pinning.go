@@ -0,0 +1,188 @@
+package request
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type PinMode int
+
+const (
+	// PinAndCA requires a normal CA-verified chain that contains a pinned key.
+	PinAndCA PinMode = iota
+	// PinOnly skips CA verification and trusts a leaf whose key is pinned,
+	// which suits internal services with self-signed certificates. Names
+	// given with WithExpectedNames or WithServerName are still checked
+	// against the leaf.
+	PinOnly
+)
+
+var ErrPinMismatch = errors.New("tls: no pinned public key in the server certificate chain")
+
+// errNoServerName fails hosts given as an IP address when we verify the
+// chain ourselves: crypto/tls leaves ConnectionState.ServerName empty for
+// them and x509 would skip the name check altogether.
+var errNoServerName = errors.New("tls: no server name to verify the certificate against, set WithExpectedNames for IP address hosts")
+
+type peerVerification struct {
+	pins          map[string]bool
+	pinMode       PinMode
+	serverName    string
+	expectedNames []string
+	verifyPeer    func(cs tls.ConnectionState) error
+}
+
+// WithPinnedKeys pins the SHA-256 of the server's SubjectPublicKeyInfo,
+// base64 encoded as printed by SPKIPin, optionally prefixed with "sha256/".
+func WithPinnedKeys(mode PinMode, pins ...string) Option {
+	return func(o *options) {
+		if o.peer.pins == nil {
+			o.peer.pins = map[string]bool{}
+		}
+		for _, pin := range pins {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+			raw, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(raw) != sha256.Size {
+				o.setErr(fmt.Errorf("invalid public key pin %q", pin))
+				return
+			}
+			o.peer.pins[pin] = true
+		}
+		o.peer.pinMode = mode
+	}
+}
+
+// WithServerName sends serverName as SNI and verifies the certificate against
+// it instead of the host in the URL.
+func WithServerName(serverName string) Option {
+	return func(o *options) {
+		o.peer.serverName = serverName
+	}
+}
+
+// WithExpectedNames accepts a server certificate valid for any of names
+// rather than for the host that was dialed.
+func WithExpectedNames(names ...string) Option {
+	return func(o *options) {
+		o.peer.expectedNames = append(o.peer.expectedNames, names...)
+	}
+}
+
+// WithVerifyPeer runs verify after the CA, name and pin checks, its error
+// aborts the handshake.
+func WithVerifyPeer(verify func(cs tls.ConnectionState) error) Option {
+	return func(o *options) {
+		o.peer.verifyPeer = verify
+	}
+}
+
+// SPKIPin returns the pin of cert for WithPinnedKeys.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (p *peerVerification) enabled() bool {
+	return len(p.pins) > 0 || len(p.expectedNames) > 0 || p.verifyPeer != nil
+}
+
+// verify checks the pins and runs the callback. chains are the verified
+// chains, nil when CA verification was skipped.
+func (p *peerVerification) verify(cs tls.ConnectionState, chains [][]*x509.Certificate) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server presented no certificates")
+	}
+
+	if len(p.pins) > 0 {
+		// without a verified chain only the leaf proves possession of its key
+		candidates := []*x509.Certificate{cs.PeerCertificates[0]}
+		for _, chain := range chains {
+			candidates = append(candidates, chain...)
+		}
+		if !p.pinned(candidates) {
+			return ErrPinMismatch
+		}
+	}
+
+	if p.verifyPeer != nil {
+		return p.verifyPeer(cs)
+	}
+	return nil
+}
+
+// pinOnly reports whether pins replace CA verification.
+func (p *peerVerification) pinOnly() bool {
+	return len(p.pins) > 0 && p.pinMode == PinOnly
+}
+
+// verifyLeafName checks the leaf against the names given explicitly with
+// WithExpectedNames or WithServerName when no chain is verified.
+func (p *peerVerification) verifyLeafName(cs tls.ConnectionState) error {
+	names := p.expectedNames
+	if len(names) == 0 && p.serverName != "" {
+		names = []string{p.serverName}
+	}
+	if len(names) == 0 || len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+
+	var firstErr error
+	for _, name := range names {
+		err := cs.PeerCertificates[0].VerifyHostname(name)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *peerVerification) verifyChain(cs tls.ConnectionState, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("tls: server presented no certificates")
+	}
+	names := p.expectedNames
+	if len(names) == 0 {
+		if cs.ServerName == "" {
+			return nil, errNoServerName
+		}
+		names = []string{cs.ServerName}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	var firstErr error
+	for _, name := range names {
+		chains, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       name,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err == nil {
+			return chains, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+func (p *peerVerification) pinned(certs []*x509.Certificate) bool {
+	for _, cert := range certs {
+		if p.pins[SPKIPin(cert)] {
+			return true
+		}
+	}
+	return false
+}
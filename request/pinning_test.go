@@ -0,0 +1,88 @@
+package request
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+// errAny stands for any error in the tables below.
+var errAny = errors.New("any error")
+
+func TestPeerVerification(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	leaf := newTestCert(t, "server", ca, "127.0.0.1")
+	server := newTLSServer(t, leaf)
+	// trusted, but not for the address dialed
+	other := newTLSServer(t, newTestCert(t, "server", ca, "foo.example"))
+	self := newTestCert(t, "self", nil, "127.0.0.1")
+	selfSigned := newTLSServer(t, self)
+	unknown := SPKIPin(newTestCert(t, "unknown", nil).cert)
+	trustCA := WithRootCAs(ca.cert)
+	acceptAll := WithVerifyPeer(func(tls.ConnectionState) error { return nil })
+
+	tests := []struct {
+		name    string
+		url     string
+		opts    []Option
+		wantErr error // nil for success, errAny for any error
+	}{
+		{"CA pin", server.URL, []Option{trustCA, WithPinnedKeys(PinAndCA, SPKIPin(ca.cert))}, nil},
+		{"leaf pin", server.URL, []Option{trustCA, WithPinnedKeys(PinAndCA, "sha256/"+SPKIPin(leaf.cert))}, nil},
+		{"pin mismatch", server.URL, []Option{trustCA, WithPinnedKeys(PinAndCA, unknown)}, ErrPinMismatch},
+		{"pin on another host", other.URL, []Option{trustCA, WithPinnedKeys(PinAndCA, SPKIPin(ca.cert))}, errAny},
+		{"callback on another host", other.URL, []Option{trustCA, acceptAll}, errAny},
+		{"pin without CA", selfSigned.URL, []Option{WithPinnedKeys(PinAndCA, SPKIPin(self.cert))}, errAny},
+		{"pin only self-signed", selfSigned.URL, []Option{WithPinnedKeys(PinOnly, SPKIPin(self.cert))}, nil},
+		{"pin only mismatch", selfSigned.URL, []Option{WithPinnedKeys(PinOnly, unknown)}, ErrPinMismatch},
+		{"pin only without pins", selfSigned.URL, []Option{WithPinnedKeys(PinOnly)}, errAny},
+		{"pin only expected name", selfSigned.URL, []Option{WithPinnedKeys(PinOnly, SPKIPin(self.cert)), WithExpectedNames("127.0.0.1")}, nil},
+		{"pin only wrong expected name", selfSigned.URL, []Option{WithPinnedKeys(PinOnly, SPKIPin(self.cert)), WithExpectedNames("foo.example")}, errAny},
+		{"pin only wrong server name", selfSigned.URL, []Option{WithPinnedKeys(PinOnly, SPKIPin(self.cert)), WithServerName("foo.example")}, errAny},
+		{"expected name", other.URL, []Option{trustCA, WithExpectedNames("bar.example", "foo.example")}, nil},
+		{"wrong expected name", other.URL, []Option{trustCA, WithExpectedNames("bar.example")}, errAny},
+		{"expected name untrusted", selfSigned.URL, []Option{trustCA, WithExpectedNames("127.0.0.1")}, errAny},
+		{"server name", other.URL, []Option{trustCA, WithServerName("foo.example")}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = c.GetResponse(context.Background(), tt.url)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatal(err)
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("expected an error")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPeerVerificationKeepsPeerCertificates(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	intermediate := newTestCert(t, "intermediate", ca)
+	leaf := newTestCert(t, "leaf", intermediate)
+	extra := newTestCert(t, "extra", nil)
+
+	peers := []*x509.Certificate{leaf.cert, intermediate.cert, extra.cert}
+	cs := tls.ConnectionState{PeerCertificates: peers}
+	chains := [][]*x509.Certificate{{leaf.cert, intermediate.cert, ca.cert}}
+
+	p := &peerVerification{pins: map[string]bool{SPKIPin(ca.cert): true}}
+	if err := p.verify(cs, chains); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []*x509.Certificate{leaf.cert, intermediate.cert, extra.cert} {
+		if peers[i] != want {
+			t.Fatalf("peer certificate %d was replaced by %q", i, peers[i].Subject.CommonName)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package request
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	// EncryptedContent is an implicit OCTET STRING, BER writers may split it
+	EncryptedContent asn1.RawValue `asn1:"tag:0,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+// DecodePKCS12 reads a .p12/.pfx bundle. cert holds the private key and the
+// certificate matching it followed by its issuers from the bundle; caCerts
+// are all other certificates in the bundle, typically the issuing CAs.
+func DecodePKCS12(pfxData []byte, password string) (cert tls.Certificate, caCerts []*x509.Certificate, err error) {
+	var pfx pfxPdu
+	if err := unmarshalDER(pfxData, &pfx); err != nil {
+		return cert, nil, fmt.Errorf("pkcs12: invalid bundle: %v", err)
+	}
+	if pfx.Version != 3 {
+		return cert, nil, fmt.Errorf("pkcs12: unsupported version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return cert, nil, errors.New("pkcs12: only password integrity mode is supported")
+	}
+
+	var authSafe []byte
+	if err := unmarshalDER(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return cert, nil, fmt.Errorf("pkcs12: invalid bundle: %v", err)
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) > 0 {
+		if err := pfx.MacData.verify(authSafe, password); err != nil {
+			return cert, nil, fmt.Errorf("pkcs12: %w", err)
+		}
+	}
+
+	var contents []contentInfo
+	if err := unmarshalDER(authSafe, &contents); err != nil {
+		return cert, nil, fmt.Errorf("pkcs12: invalid bundle: %v", err)
+	}
+
+	var key crypto.PrivateKey
+	var certs []*x509.Certificate
+	for _, ci := range contents {
+		bags, err := ci.safeBags(password)
+		if err != nil {
+			return cert, nil, err
+		}
+
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var cb certBag
+				if err := unmarshalDER(bag.Value.Bytes, &cb); err != nil {
+					return cert, nil, fmt.Errorf("pkcs12: invalid certificate bag: %v", err)
+				}
+				if !cb.ID.Equal(oidX509Certificate) {
+					continue
+				}
+				c, err := x509.ParseCertificate(cb.Data)
+				if err != nil {
+					return cert, nil, fmt.Errorf("pkcs12: %w", err)
+				}
+				certs = append(certs, c)
+			case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+				if key != nil {
+					return cert, nil, errors.New("pkcs12: bundle holds more than one private key")
+				}
+				der := bag.Value.Bytes
+				if bag.ID.Equal(oidPKCS8ShroudedKeyBag) {
+					if der, err = decryptPKCS8(der, password); err != nil {
+						return cert, nil, fmt.Errorf("pkcs12: %w", err)
+					}
+				}
+				if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+					return cert, nil, fmt.Errorf("pkcs12: %w", err)
+				}
+			}
+		}
+	}
+
+	if key == nil {
+		return cert, nil, errors.New("pkcs12: bundle holds no private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return cert, nil, errors.New("pkcs12: unsupported private key type")
+	}
+
+	leaf := -1
+	for i, c := range certs {
+		if pub, ok := c.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && pub.Equal(signer.Public()) {
+			leaf = i
+			break
+		}
+	}
+	if leaf < 0 {
+		return cert, nil, errors.New("pkcs12: no certificate matches the private key")
+	}
+
+	chain := []*x509.Certificate{certs[leaf]}
+	caCerts = append(append(caCerts, certs[:leaf]...), certs[leaf+1:]...)
+	chain = append(chain, issuerChain(certs[leaf], caCerts)...)
+
+	cert.PrivateKey = key
+	cert.Leaf = certs[leaf]
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, caCerts, nil
+}
+
+// issuerChain follows the issuers of leaf through certs, stopping at a
+// self-signed certificate or when no issuer is in certs.
+func issuerChain(leaf *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	var chain []*x509.Certificate
+	used := map[*x509.Certificate]bool{}
+	for c := leaf; ; {
+		if string(c.RawIssuer) == string(c.RawSubject) {
+			return chain
+		}
+		var issuer *x509.Certificate
+		for _, candidate := range certs {
+			if !used[candidate] && string(candidate.RawSubject) == string(c.RawIssuer) && c.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			return chain
+		}
+		used[issuer] = true
+		chain = append(chain, issuer)
+		c = issuer
+	}
+}
+
+func (ci contentInfo) safeBags(password string) ([]safeBag, error) {
+	var data []byte
+	switch {
+	case ci.ContentType.Equal(oidDataContentType):
+		if err := unmarshalDER(ci.Content.Bytes, &data); err != nil {
+			return nil, fmt.Errorf("pkcs12: invalid bundle: %v", err)
+		}
+	case ci.ContentType.Equal(oidEncryptedDataContentType):
+		var ed encryptedData
+		if err := unmarshalDER(ci.Content.Bytes, &ed); err != nil {
+			return nil, fmt.Errorf("pkcs12: invalid encrypted content: %v", err)
+		}
+		encrypted := ed.EncryptedContentInfo.EncryptedContent.Bytes
+		var err error
+		if ed.EncryptedContentInfo.EncryptedContent.IsCompound {
+			if encrypted, err = joinOctetStrings(encrypted); err != nil {
+				return nil, fmt.Errorf("pkcs12: invalid encrypted content: %v", err)
+			}
+		}
+		data, err = pbeDecrypt(ed.EncryptedContentInfo.ContentEncryptionAlgorithm, encrypted, password)
+		if err != nil {
+			return nil, fmt.Errorf("pkcs12: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("pkcs12: unsupported content type %v", ci.ContentType)
+	}
+
+	var bags []safeBag
+	if err := unmarshalDER(data, &bags); err != nil {
+		return nil, fmt.Errorf("pkcs12: invalid safe contents: %v", err)
+	}
+	return bags, nil
+}
+
+func (m macData) verify(content []byte, password string) error {
+	var h func() hash.Hash
+	var v int
+	switch alg := m.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		h, v = sha1.New, 64
+	case alg.Equal(oidSHA256):
+		h, v = sha256.New, 64
+	case alg.Equal(oidSHA384):
+		h, v = sha512.New384, 128
+	case alg.Equal(oidSHA512):
+		h, v = sha512.New, 128
+	default:
+		return fmt.Errorf("unsupported MAC algorithm %v", alg)
+	}
+	if m.Iterations <= 0 {
+		return errors.New("invalid MAC iteration count")
+	}
+
+	passwords := [][]byte{bmpString(password)}
+	if password == "" {
+		// tools disagree on whether an empty password is terminated
+		passwords = append(passwords, nil)
+	}
+	for _, pass := range passwords {
+		key := pkcs12KDF(h, v, pass, m.MacSalt, m.Iterations, 3, h().Size())
+		mac := hmac.New(h, key)
+		mac.Write(content)
+		if hmac.Equal(mac.Sum(nil), m.Mac.Digest) {
+			return nil
+		}
+	}
+	return ErrIncorrectPassword
+}
+
+// unmarshalDER decodes exactly one value, accepting the indefinite lengths and
+// chunked OCTET STRINGs some PKCS#12 writers emit.
+func unmarshalDER(b []byte, v interface{}) error {
+	der, err := berToDER(b)
+	if err != nil {
+		return err
+	}
+	rest, err := asn1.Unmarshal(der, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
+
+var errInvalidBER = errors.New("invalid BER encoding")
+
+func berToDER(b []byte) ([]byte, error) {
+	der, rest, err := convertBER(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data")
+	}
+	return der, nil
+}
+
+// convertBER re-encodes the first element of b with definite lengths and
+// returns it with the input that follows it.
+func convertBER(b []byte) (der, rest []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, errInvalidBER
+	}
+	i := 1
+	if b[0]&0x1f == 0x1f {
+		for i < len(b) && b[i]&0x80 != 0 {
+			i++
+		}
+		i++
+	}
+	if i >= len(b) {
+		return nil, nil, errInvalidBER
+	}
+	tag := b[:i]
+	constructed := b[0]&0x20 != 0
+
+	var content []byte
+	if b[i] == 0x80 {
+		if !constructed {
+			return nil, nil, errInvalidBER
+		}
+		rest = b[i+1:]
+		for {
+			if len(rest) < 2 {
+				return nil, nil, errInvalidBER
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			var child []byte
+			if child, rest, err = convertBER(rest); err != nil {
+				return nil, nil, err
+			}
+			content = append(content, child...)
+		}
+	} else {
+		n := int(b[i])
+		i++
+		if n&0x80 != 0 {
+			count := n & 0x7f
+			if count > 4 || i+count > len(b) {
+				return nil, nil, errInvalidBER
+			}
+			n = 0
+			for _, c := range b[i : i+count] {
+				n = n<<8 | int(c)
+			}
+			i += count
+		}
+		if n < 0 || n > len(b)-i {
+			return nil, nil, errInvalidBER
+		}
+		content, rest = b[i:i+n], b[i+n:]
+
+		if constructed {
+			var converted []byte
+			for r := content; len(r) > 0; {
+				var child []byte
+				if child, r, err = convertBER(r); err != nil {
+					return nil, nil, err
+				}
+				converted = append(converted, child...)
+			}
+			content = converted
+		}
+	}
+
+	// DER only knows primitive OCTET STRINGs, BER may send them in chunks
+	if len(tag) == 1 && tag[0] == 0x24 {
+		if content, err = joinOctetStrings(content); err != nil {
+			return nil, nil, err
+		}
+		tag = []byte{0x04}
+	}
+
+	der = append(append([]byte{}, tag...), derLength(len(content))...)
+	return append(der, content...), rest, nil
+}
+
+// joinOctetStrings concatenates the DER OCTET STRINGs making up a constructed one.
+func joinOctetStrings(b []byte) ([]byte, error) {
+	joined := []byte{}
+	for len(b) > 0 {
+		var chunk asn1.RawValue
+		rest, err := asn1.Unmarshal(b, &chunk)
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Class != asn1.ClassUniversal || chunk.Tag != asn1.TagOctetString || chunk.IsCompound {
+			return nil, errInvalidBER
+		}
+		joined = append(joined, chunk.Bytes...)
+		b = rest
+	}
+	return joined, nil
+}
+
+func derLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
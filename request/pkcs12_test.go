@@ -0,0 +1,272 @@
+package request
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"testing"
+)
+
+func TestDecodePKCS12(t *testing.T) {
+	tests := []struct {
+		file     string
+		password string
+	}{
+		{"aes.p12", testPassword},
+		{"3des.p12", testPassword},
+		{"nopass.p12", ""},
+		{"rc2-128.p12", testPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			checkClientBundle(t, readTestdata(t, tt.file), tt.password)
+		})
+	}
+}
+
+// checkClientBundle decodes a bundle holding client.pem, int.pem and ca.pem.
+func checkClientBundle(t *testing.T, pfxData []byte, password string) {
+	cert, caCerts, err := DecodePKCS12(pfxData, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.Subject.CommonName != "client" {
+		t.Fatalf("leaf is %q, want client", cert.Leaf.Subject.CommonName)
+	}
+	if !cert.PrivateKey.(crypto.Signer).Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(cert.Leaf.PublicKey) {
+		t.Fatal("private key does not match the leaf")
+	}
+	// the leaf and its issuers up to the root, in order
+	if len(cert.Certificate) != 3 {
+		t.Fatalf("chain has %d certificates, want 3", len(cert.Certificate))
+	}
+	for i, want := range []string{"int.pem", "ca.pem"} {
+		block, _ := pem.Decode(readTestdata(t, want))
+		if !bytes.Equal(cert.Certificate[i+1], block.Bytes) {
+			t.Fatalf("chain[%d] is not %s", i+1, want)
+		}
+	}
+	if len(caCerts) != 2 {
+		t.Fatalf("got %d CA certificates, want 2", len(caCerts))
+	}
+}
+
+func TestDecodePKCS12WrongPassword(t *testing.T) {
+	tests := []struct {
+		file     string
+		password string
+	}{
+		{"aes.p12", "wrong"},
+		{"aes.p12", ""},
+		{"3des.p12", "wrong"},
+		{"nopass.p12", "wrong"},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := DecodePKCS12(readTestdata(t, tt.file), tt.password); !errors.Is(err, ErrIncorrectPassword) {
+			t.Errorf("%s with %q: got %v, want %v", tt.file, tt.password, err, ErrIncorrectPassword)
+		}
+	}
+}
+
+// rc2.p12 is an OpenSSL -legacy export, certificates under 40-bit RC2.
+func TestDecodePKCS12RC2(t *testing.T) {
+	cert, caCerts, err := DecodePKCS12(readTestdata(t, "rc2.p12"), testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.Subject.CommonName != "client" {
+		t.Fatalf("leaf is %q, want client", cert.Leaf.Subject.CommonName)
+	}
+	if !cert.PrivateKey.(crypto.Signer).Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(cert.Leaf.PublicKey) {
+		t.Fatal("private key does not match the leaf")
+	}
+	if len(caCerts) != 0 {
+		t.Fatalf("got %d CA certificates, want none", len(caCerts))
+	}
+	if _, _, err := DecodePKCS12(readTestdata(t, "rc2.p12"), "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("got %v, want %v", err, ErrIncorrectPassword)
+	}
+}
+
+func TestDecodePKCS12Invalid(t *testing.T) {
+	if _, _, err := DecodePKCS12([]byte("not a bundle"), testPassword); err == nil {
+		t.Fatal("expected an error for garbage input")
+	}
+	data := readTestdata(t, "aes.p12")
+	if _, _, err := DecodePKCS12(data[:len(data)/2], testPassword); err == nil {
+		t.Fatal("expected an error for a truncated bundle")
+	}
+}
+
+func TestDecodePKCS12IndefiniteLength(t *testing.T) {
+	for _, file := range []string{"aes.p12", "3des.p12"} {
+		t.Run(file, func(t *testing.T) {
+			ber := toBERPKCS12(t, readTestdata(t, file), testPassword)
+			if !bytes.HasPrefix(ber, []byte{0x30, 0x80}) || !bytes.Contains(ber, []byte{0x24, 0x80}) {
+				t.Fatal("bundle was not re-encoded with indefinite lengths")
+			}
+			checkClientBundle(t, ber, testPassword)
+
+			if _, _, err := DecodePKCS12(ber, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+				t.Fatalf("got %v, want %v", err, ErrIncorrectPassword)
+			}
+		})
+	}
+}
+
+func TestNewHttpsClientX509PKCS12WithoutCA(t *testing.T) {
+	noCA := readTestdata(t, "noca.p12")
+	if _, err := NewHttpsClientX509PKCS12WithBytes(nil, noCA, testPassword, false); err != errNoPKCS12CA {
+		t.Fatalf("got %v, want %v", err, errNoPKCS12CA)
+	}
+	if _, err := NewHttpsClientX509PKCS12WithBytes(readTestdata(t, "ca.pem"), noCA, testPassword, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHttpsClientX509PKCS12WithBytes(nil, noCA, testPassword, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHttpsClientX509PKCS12WithBytes(nil, readTestdata(t, "aes.p12"), testPassword, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	tests := []struct {
+		name string
+		ber  string
+		want string
+	}{
+		{"definite", "3003020101", "3003020101"},
+		{"indefinite sequence", "3080020101" + "0000", "3003020101"},
+		{"nested", "3080" + "3080" + "020101" + "0000" + "0000", "30053003020101"},
+		{"chunked octet string", "2480" + "04026869" + "0401" + "21" + "0000", "0403686921"},
+		{"chunked definite octet string", "2407" + "04026869" + "040121", "0403686921"},
+		{"explicit tag around chunks", "a080" + "2480" + "040161" + "0000" + "0000", "a003040161"},
+		{"long form length", "048103616263", "0403616263"},
+	}
+
+	for _, tt := range tests {
+		der, err := berToDER(mustHex(t, tt.ber))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(der, mustHex(t, tt.want)) {
+			t.Errorf("%s: got %x, want %s", tt.name, der, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"30",
+		"3080020101",               // no end of contents
+		"0480616263" + "0000",      // indefinite primitive
+		"3005020101",               // length past the end
+		"2480" + "020101" + "0000", // chunk that is not an OCTET STRING
+		"3003020101" + "00",        // trailing data
+	} {
+		if _, err := berToDER(mustHex(t, bad)); err == nil {
+			t.Errorf("berToDER(%s) succeeded, want an error", bad)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// toBERPKCS12 re-encodes a DER bundle the way some Windows and Java exports
+// look: indefinite lengths throughout and OCTET STRINGs split into chunks,
+// both for the outer PFX and inside the MAC protected content, whose MAC is
+// recomputed with password.
+func toBERPKCS12(t *testing.T, der []byte, password string) []byte {
+	var pfx pfxPdu
+	if _, err := asn1.Unmarshal(der, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		t.Fatal(err)
+	}
+	authSafe = toBER(t, authSafe)
+
+	var h func() hash.Hash
+	switch alg := pfx.MacData.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		h = sha1.New
+	case alg.Equal(oidSHA256):
+		h = sha256.New
+	default:
+		t.Fatalf("unexpected MAC algorithm %v", alg)
+	}
+	key := pkcs12KDF(h, 64, bmpString(password), pfx.MacData.MacSalt, pfx.MacData.Iterations, 3, h().Size())
+	mac := hmac.New(h, key)
+	mac.Write(authSafe)
+	pfx.MacData.Mac.Digest = mac.Sum(nil)
+
+	content, err := asn1.Marshal(authSafe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfx.AuthSafe.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content}
+	der, err = asn1.Marshal(pfx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return toBER(t, der)
+}
+
+// toBER gives every constructed element an indefinite length and splits
+// OCTET STRINGs and [0] IMPLICIT OCTET STRINGs longer than 32 bytes into
+// chunks. It does not look inside OCTET STRINGs.
+func toBER(t *testing.T, der []byte) []byte {
+	const chunk = 32
+	var out []byte
+	for len(der) > 0 {
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(der, &raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw.Tag >= 31 {
+			t.Fatalf("high tag numbers are not supported")
+		}
+		id := raw.FullBytes[0]
+
+		switch {
+		case raw.IsCompound:
+			out = append(out, id, 0x80)
+			out = append(out, toBER(t, raw.Bytes)...)
+			out = append(out, 0, 0)
+		case len(raw.Bytes) > chunk && (id == 0x04 || id == 0x80):
+			out = append(out, id|0x20, 0x80)
+			for b := raw.Bytes; len(b) > 0; {
+				n := chunk
+				if n > len(b) {
+					n = len(b)
+				}
+				out = append(out, 0x04, byte(n))
+				out = append(out, b[:n]...)
+				b = b[n:]
+			}
+			out = append(out, 0, 0)
+		default:
+			out = append(out, raw.FullBytes...)
+		}
+		der = rest
+	}
+	return out
+}
@@ -0,0 +1,328 @@
+package request
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNoProxyMatcher(t *testing.T) {
+	tests := []struct {
+		entries []string
+		url     string
+		want    bool
+	}{
+		{nil, "http://example.com", false},
+		{[]string{"*"}, "http://example.com", true},
+		{[]string{"example.com"}, "http://example.com", true},
+		{[]string{"example.com"}, "http://api.example.com", true},
+		{[]string{"example.com"}, "http://notexample.com", false},
+		{[]string{"EXAMPLE.com "}, "http://Example.COM", true},
+		{[]string{".example.com"}, "http://example.com", false},
+		{[]string{".example.com"}, "http://api.example.com", true},
+		{[]string{"example.com:8080"}, "http://example.com:8080", true},
+		{[]string{"example.com:8080"}, "http://example.com", false},
+		{[]string{"example.com:443"}, "https://example.com", true},
+		{[]string{"example.com:80"}, "https://example.com", false},
+		{[]string{"10.0.0.0/8"}, "http://10.1.2.3", true},
+		{[]string{"10.0.0.0/8"}, "http://11.1.2.3", false},
+		{[]string{"10.0.0.0/8"}, "http://ten.example.com", false},
+		{[]string{"fd00::/8"}, "http://[fd00::1]:8080", true},
+		{[]string{"192.168.1.1"}, "http://192.168.1.1:9000", true},
+		{[]string{"[::1]:8080"}, "http://[::1]:8080", true},
+		{[]string{"[::1]:8080"}, "http://[::1]:9090", false},
+		{[]string{"", "other.com", "example.com"}, "http://example.com", true},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := NoProxyMatcher(tt.entries...)(u); got != tt.want {
+			t.Errorf("NoProxyMatcher(%q)(%s) = %v, want %v", tt.entries, tt.url, got, tt.want)
+		}
+	}
+}
+
+// newTestProxy is a forward proxy requiring user:pass, tunnelling CONNECT.
+func newTestProxy(t *testing.T, requests *int32) *httptest.Server {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+		if r.Header.Get("Proxy-Authorization") != want {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method != http.MethodConnect {
+			w.Write([]byte("proxied " + r.URL.String()))
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go io.Copy(target, rw)
+		io.Copy(conn, target)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestProxyHTTP(t *testing.T) {
+	var requests int32
+	proxy := newTestProxy(t, &requests)
+	proxyURL := strings.Replace(proxy.URL, "http://", "http://user:pass@", 1)
+
+	client, err := New(WithProxy(proxyURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.GetResponse(context.Background(), "http://upstream.invalid/path?q=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Body); got != "proxied http://upstream.invalid/path?q=1" {
+		t.Fatalf("got %q", got)
+	}
+
+	// bad credentials come back as the proxy's 407
+	client, err = New(WithProxy(strings.Replace(proxy.URL, "http://", "http://user:wrong@", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = client.GetResponse(context.Background(), "http://upstream.invalid/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusProxyAuthRequired {
+		t.Fatalf("status %d, want 407", res.StatusCode)
+	}
+}
+
+func TestProxyConnect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tunnelled " + r.URL.Path))
+	}))
+	defer target.Close()
+
+	var requests int32
+	proxy := newTestProxy(t, &requests)
+	proxyURL := strings.Replace(proxy.URL, "http://", "http://user:pass@", 1)
+
+	client, err := New(WithProxy(proxyURL), WithRootCAs(target.Certificate()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.GetResponse(context.Background(), target.URL+"/secure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Body); got != "tunnelled /secure" {
+		t.Fatalf("got %q", got)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("proxy saw %d requests, want 1 CONNECT", n)
+	}
+
+	// the target itself is in NO_PROXY, so the proxy is not used
+	client, err = New(WithProxy(proxyURL, "127.0.0.1"), WithRootCAs(target.Certificate()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetResponse(context.Background(), target.URL+"/direct"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("proxy saw %d requests, want the bypassed one to go direct", n)
+	}
+}
+
+// newTestSOCKS5 is a SOCKS5 proxy (RFC 1928) requiring user:pass (RFC 1929)
+// that only serves CONNECT. It returns the proxy address and the
+// destinations it connected to.
+func newTestSOCKS5(t *testing.T) (string, func() []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	var targets []string
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				target, err := socks5Handshake(conn)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				targets = append(targets, target)
+				mu.Unlock()
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), targets...)
+	}
+}
+
+// socks5Handshake authenticates the client and reads its CONNECT request.
+func socks5Handshake(conn net.Conn) (string, error) {
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(conn, b)
+		return b, err
+	}
+
+	head, err := read(2)
+	if err != nil {
+		return "", err
+	}
+	methods, err := read(int(head[1]))
+	if err != nil {
+		return "", err
+	}
+	if head[0] != 5 || !strings.ContainsRune(string(methods), 2) {
+		conn.Write([]byte{5, 0xff})
+		return "", io.ErrUnexpectedEOF
+	}
+	conn.Write([]byte{5, 2})
+
+	// username/password sub-negotiation
+	ver, err := read(2)
+	if err != nil {
+		return "", err
+	}
+	user, err := read(int(ver[1]))
+	if err != nil {
+		return "", err
+	}
+	passLen, err := read(1)
+	if err != nil {
+		return "", err
+	}
+	pass, err := read(int(passLen[0]))
+	if err != nil {
+		return "", err
+	}
+	if string(user) != "user" || string(pass) != "pass" {
+		conn.Write([]byte{1, 1})
+		return "", io.ErrUnexpectedEOF
+	}
+	conn.Write([]byte{1, 0})
+
+	req, err := read(4)
+	if err != nil {
+		return "", err
+	}
+	if req[1] != 1 {
+		conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+		return "", io.ErrUnexpectedEOF
+	}
+	var host string
+	switch req[3] {
+	case 1, 4:
+		size := net.IPv4len
+		if req[3] == 4 {
+			size = net.IPv6len
+		}
+		ip, err := read(size)
+		if err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n, err := read(1)
+		if err != nil {
+			return "", err
+		}
+		name, err := read(int(n[0]))
+		if err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", io.ErrUnexpectedEOF
+	}
+	port, err := read(2)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+func TestProxySOCKS5(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socks " + r.URL.Path))
+	}))
+	defer target.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socks " + r.URL.Path))
+	}))
+	defer secure.Close()
+
+	addr, targets := newTestSOCKS5(t)
+	client, err := New(WithProxy("socks5://user:pass@"+addr), WithRootCAs(secure.Certificate()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range []*httptest.Server{target, secure} {
+		res, err := client.GetResponse(context.Background(), ts.URL+"/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(res.Body); got != "via socks /path" {
+			t.Fatalf("got %q", got)
+		}
+	}
+	want := []string{target.Listener.Addr().String(), secure.Listener.Addr().String()}
+	if got := targets(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("proxy connected to %q, want %q", got, want)
+	}
+
+	client, err = New(WithProxy("socks5://user:wrong@" + addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetResponse(context.Background(), target.URL); err == nil {
+		t.Fatal("expected an error for bad proxy credentials")
+	}
+}
@@ -0,0 +1,248 @@
+package request
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket refilled at rate tokens per second and
+// holding at most burst tokens. A rate of zero only enforces pauses.
+type RateLimiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	last       time.Time
+	pauseUntil time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	wait := l.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	if err := sleepContext(ctx, wait); err != nil {
+		l.cancel()
+		return err
+	}
+	return nil
+}
+
+// PauseUntil holds every caller back until t, e.g. when the server says its quota is spent.
+func (l *RateLimiter) PauseUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t.After(l.pauseUntil) {
+		l.pauseUntil = t
+	}
+}
+
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	if l.pauseUntil.After(now) {
+		wait = l.pauseUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return wait
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+
+	if l.tokens < 0 {
+		if refill := time.Duration(-l.tokens / l.rate * float64(time.Second)); refill > wait {
+			wait = refill
+		}
+	}
+	return wait
+}
+
+// idle reports whether the limiter is back to a full bucket with no pause
+// pending, so replacing it with a new one would change nothing.
+func (l *RateLimiter) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.pauseUntil.After(now) {
+		return false
+	}
+	return l.rate <= 0 || l.last.IsZero() || l.tokens+now.Sub(l.last).Seconds()*l.rate >= l.burst
+}
+
+// cancel gives back the token of a Wait whose request is not sent after all.
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate > 0 && l.tokens < l.burst {
+		l.tokens++
+	}
+}
+
+// maxIdleHostLimiters is how many per-host limiters a RateLimit middleware
+// keeps before dropping those that have refilled and are not paused.
+const maxIdleHostLimiters = 1024
+
+// RateLimit configures WithRateLimit. Zero values switch the matching limit off.
+type RateLimit struct {
+	QPS   float64
+	Burst int
+	// PerHostQPS and PerHostBurst limit each host on its own.
+	PerHostQPS   float64
+	PerHostBurst int
+	// MaxInFlight caps requests whose response body has not been closed yet.
+	MaxInFlight int
+	// Adaptive pauses a host after a 429 with Retry-After, or once
+	// X-RateLimit-Remaining drops to 0, until X-RateLimit-Reset.
+	Adaptive bool
+}
+
+func WithRateLimit(limit RateLimit) Option {
+	return WithMiddleware(limit.Middleware())
+}
+
+func (limit RateLimit) Middleware() Middleware {
+	var global *RateLimiter
+	if limit.QPS > 0 {
+		global = NewRateLimiter(limit.QPS, limit.Burst)
+	}
+	var inFlight chan struct{}
+	if limit.MaxInFlight > 0 {
+		inFlight = make(chan struct{}, limit.MaxInFlight)
+	}
+
+	var mu sync.Mutex
+	hosts := map[string]*RateLimiter{}
+	sweepAt := maxIdleHostLimiters
+	hostLimiter := func(host string) *RateLimiter {
+		mu.Lock()
+		defer mu.Unlock()
+
+		l, ok := hosts[host]
+		if !ok {
+			if len(hosts) >= sweepAt {
+				now := time.Now()
+				for h, hl := range hosts {
+					if hl.idle(now) {
+						delete(hosts, h)
+					}
+				}
+				// hosts still busy stay, sweep again once as many have been added
+				sweepAt = 2 * len(hosts)
+				if sweepAt < maxIdleHostLimiters {
+					sweepAt = maxIdleHostLimiters
+				}
+			}
+			l = NewRateLimiter(limit.PerHostQPS, limit.PerHostBurst)
+			hosts[host] = l
+		}
+		return l
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			if global != nil {
+				if err := global.Wait(ctx); err != nil {
+					closeRequestBody(req)
+					return nil, err
+				}
+			}
+			host := hostLimiter(req.URL.Host)
+			if err := host.Wait(ctx); err != nil {
+				if global != nil {
+					global.cancel()
+				}
+				closeRequestBody(req)
+				return nil, err
+			}
+
+			release := func() {}
+			if inFlight != nil {
+				select {
+				case inFlight <- struct{}{}:
+				case <-ctx.Done():
+					if global != nil {
+						global.cancel()
+					}
+					host.cancel()
+					closeRequestBody(req)
+					return nil, ctx.Err()
+				}
+				var once sync.Once
+				release = func() {
+					once.Do(func() { <-inFlight })
+				}
+			}
+
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				release()
+				return res, err
+			}
+			if limit.Adaptive {
+				if until, ok := rateLimitPause(res, time.Now()); ok {
+					host.PauseUntil(until)
+				}
+			}
+			if inFlight != nil {
+				res.Body = &releaseOnClose{ReadCloser: res.Body, release: release}
+			}
+			return res, nil
+		})
+	}
+}
+
+func rateLimitPause(res *http.Response, now time.Time) (time.Time, bool) {
+	if res.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			return now.Add(wait), true
+		}
+	}
+	if res.Header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+
+	reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < 0 {
+		return time.Time{}, false
+	}
+	// some servers send an epoch timestamp, others the seconds left
+	if reset > 1e9 {
+		return time.Unix(reset, 0), true
+	}
+	return now.Add(time.Duration(reset) * time.Second), true
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
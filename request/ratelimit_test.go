@@ -0,0 +1,58 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func rateLimitRoundTripper(limit RateLimit) http.RoundTripper {
+	return limit.Middleware()(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}))
+}
+
+func TestRateLimitReturnsGlobalTokenWhenHostWaitFails(t *testing.T) {
+	rt := rateLimitRoundTripper(RateLimit{QPS: 1, Burst: 2, PerHostQPS: 0.001, PerHostBurst: 1})
+
+	// a.example uses its only host token, the second request gives up waiting for another
+	if _, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://a.example/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "http://a.example/", nil).WithContext(ctx)
+	if _, err := rt.RoundTrip(req); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the global token of the canceled request is back, so another host goes through at once
+	start := time.Now()
+	if _, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://b.example/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("waited %s for a global token", elapsed)
+	}
+}
+
+func TestRateLimiterIdle(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(10, 2)
+	if !l.idle(now) {
+		t.Fatal("unused limiter should be idle")
+	}
+	l.reserve(now)
+	if l.idle(now) {
+		t.Fatal("limiter with a spent token should not be idle")
+	}
+	if !l.idle(now.Add(200 * time.Millisecond)) {
+		t.Fatal("refilled limiter should be idle")
+	}
+	l.PauseUntil(now.Add(time.Second))
+	if l.idle(now.Add(500 * time.Millisecond)) {
+		t.Fatal("paused limiter should not be idle")
+	}
+}
@@ -0,0 +1,99 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultMaxRedirects = 10
+
+var ErrRedirectNotAllowed = errors.New("redirect not allowed")
+
+// RedirectPolicy controls which redirects a client follows. The zero value
+// follows up to DefaultMaxRedirects to any host and drops the Authorization
+// header when the scheme, host or port changes.
+type RedirectPolicy struct {
+	// NoFollow returns the 3xx response itself.
+	NoFollow     bool
+	MaxRedirects int
+	SameHostOnly bool
+	// KeepAuthorization forwards an Authorization header set by the caller to
+	// other origins as well. Credentials from an AuthProvider never leave the
+	// original origin.
+	KeepAuthorization bool
+}
+
+func WithRedirectPolicy(policy RedirectPolicy) Option {
+	return func(o *options) {
+		o.redirect = &policy
+	}
+}
+
+func (policy *RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if policy.NoFollow {
+		return http.ErrUseLastResponse
+	}
+
+	max := policy.MaxRedirects
+	if max <= 0 {
+		max = DefaultMaxRedirects
+	}
+	if len(via) > max {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrRedirectNotAllowed, max)
+	}
+
+	first := via[0]
+	if policy.SameHostOnly && !strings.EqualFold(req.URL.Host, first.URL.Host) {
+		return fmt.Errorf("%w: %s is not on %s", ErrRedirectNotAllowed, req.URL.Host, first.URL.Host)
+	}
+	if policy.KeepAuthorization {
+		// net/http has already dropped it if the domain changed
+		if auth := first.Header.Get("Authorization"); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+	} else if !sameOrigin(req.URL, first.URL) {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Hostname(), b.Hostname()) && effectivePort(a) == effectivePort(b)
+}
+
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// originalRequest walks back through the redirects that led to req.
+func originalRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+	return req
+}
+
+// isCrossOriginRedirect reports whether req follows a redirect away from the
+// origin of the request the caller made.
+func isCrossOriginRedirect(req *http.Request) bool {
+	return req.Response != nil && !sameOrigin(req.URL, originalRequest(req).URL)
+}
+
+// redirectChain lists the URLs visited before the final request, oldest first.
+func redirectChain(final *http.Request) []*url.URL {
+	var chain []*url.URL
+	for req := final; req.Response != nil && req.Response.Request != nil; {
+		req = req.Response.Request
+		chain = append([]*url.URL{req.URL}, chain...)
+	}
+	return chain
+}
@@ -0,0 +1,54 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirectAuthorization(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer target.Close()
+	// a different domain than 127.0.0.1, which net/http strips credentials for on its own
+	targetURL := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, targetURL, http.StatusFound)
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name   string
+		policy RedirectPolicy
+		opts   []Option
+		want   string
+	}{
+		{"dropped by default", RedirectPolicy{}, nil, ""},
+		{"kept on request", RedirectPolicy{KeepAuthorization: true}, nil, "Bearer caller"},
+		{"provider stays on origin", RedirectPolicy{KeepAuthorization: true}, []Option{WithAuth(BearerToken("provider"))}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(append([]Option{WithRedirectPolicy(tt.policy)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var headers []*Header
+			if tt.opts == nil {
+				headers = append(headers, &Header{Key: "Authorization", Value: "Bearer caller"})
+			}
+			res, err := client.GetResponse(context.Background(), origin.URL, headers...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(res.Body); got != tt.want {
+				t.Fatalf("target saw Authorization %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package requesttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type Mode int
+
+const (
+	// ModeReplay answers from the golden file and never touches the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests for real and keeps the exchanges for Save.
+	ModeRecord
+	// ModeAuto replays when the golden file exists and records otherwise.
+	ModeAuto
+)
+
+const redacted = "REDACTED"
+
+// RedactedHeaders are replaced by "REDACTED" in recorded requests.
+var RedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+// RedactedResponseHeaders are replaced by "REDACTED" in recorded responses.
+var RedactedResponseHeaders = []string{"Set-Cookie"}
+
+// Scrubber rewrites an exchange before it is written to the golden file,
+// e.g. to hide secrets in bodies or query strings. Replayed requests go
+// through the same scrubbers, with an empty Response, before they are
+// matched, so a scrubber must leave the request in a form that still
+// identifies it.
+type Scrubber func(in *Interaction)
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	// BodyBytes is used instead of Body when the body is not UTF-8.
+	BodyBytes []byte `json:"body_bytes,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBytes  []byte      `json:"body_bytes,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that records real exchanges into a
+// golden file, or replays them from it. Replayed requests match on method,
+// URL and body as they were recorded, redacted and scrubbed, each recorded
+// exchange being used once in order.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+
+	scrubbers []Scrubber
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder loads goldenFile for replay. In record mode transport sends the
+// real requests, http.DefaultTransport when nil.
+func NewRecorder(goldenFile string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if mode == ModeAuto {
+		mode = ModeRecord
+		if _, err := os.Stat(goldenFile); err == nil {
+			mode = ModeReplay
+		}
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	r := &Recorder{path: goldenFile, mode: mode, transport: transport}
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(goldenFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("requesttest: cannot parse %s: %v", goldenFile, err)
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+	return r, nil
+}
+
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// SetScrubbers runs scrubbers, in order, on every exchange after the
+// built-in header and URL user info redaction. Set them before the first request.
+func (r *Recorder) SetScrubbers(scrubbers ...Scrubber) *Recorder {
+	r.scrubbers = scrubbers
+	return r
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+	return r.record(req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	want := r.scrub(&Interaction{Request: recordRequest(req, body)}).Request
+	wantBody := decodeBody(want.Body, want.BodyBytes)
+	for i, in := range r.interactions {
+		if r.used[i] || in.Request.Method != want.Method || in.Request.URL != want.URL ||
+			!bytes.Equal(decodeBody(in.Request.Body, in.Request.BodyBytes), wantBody) {
+			continue
+		}
+		r.used[i] = true
+
+		resBody := decodeBody(in.Response.Body, in.Response.BodyBytes)
+		return &http.Response{
+			Status:        strconv.Itoa(in.Response.StatusCode) + " " + http.StatusText(in.Response.StatusCode),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(resBody)),
+			ContentLength: int64(len(resBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: no recorded exchange for %s %s in %s", ErrNoMatch, req.Method, want.URL, r.path)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	if body != nil {
+		out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	res, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	in := &Interaction{
+		Request:  recordRequest(req, body),
+		Response: RecordedResponse{StatusCode: res.StatusCode, Header: redactHeader(res.Header, RedactedResponseHeaders)},
+	}
+	in.Response.Body, in.Response.BodyBytes = encodeBody(resBody)
+	r.scrub(in)
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+	return res, nil
+}
+
+// recordRequest is req as it is written to the golden file, minus scrubbers.
+func recordRequest(req *http.Request, body []byte) RecordedRequest {
+	u := *req.URL
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	rec := RecordedRequest{Method: req.Method, URL: u.String(), Header: redactHeader(req.Header, RedactedHeaders)}
+	rec.Body, rec.BodyBytes = encodeBody(body)
+	return rec
+}
+
+func (r *Recorder) scrub(in *Interaction) *Interaction {
+	for _, scrubber := range r.scrubbers {
+		scrubber(in)
+	}
+	return in
+}
+
+func redactHeader(header http.Header, keys []string) http.Header {
+	header = header.Clone()
+	for _, key := range keys {
+		if header.Get(key) != "" {
+			header.Set(key, redacted)
+		}
+	}
+	return header
+}
+
+// ScrubQuery redacts the values of the named query parameters, e.g. the one
+// set with request.APIKeyQuery.
+func ScrubQuery(names ...string) Scrubber {
+	return func(in *Interaction) {
+		u, err := url.Parse(in.Request.URL)
+		if err != nil {
+			return
+		}
+		query := u.Query()
+		if !redactValues(query, names) {
+			return
+		}
+		u.RawQuery = query.Encode()
+		in.Request.URL = u.String()
+	}
+}
+
+// ScrubFields redacts the named fields of form encoded request bodies and of
+// JSON request and response bodies at any depth, e.g. client_secret,
+// refresh_token and access_token of an OAuth token exchange.
+func ScrubFields(names ...string) Scrubber {
+	return func(in *Interaction) {
+		if in.Request.BodyBytes == nil {
+			in.Request.Body = scrubBody(in.Request.Header.Get("Content-Type"), in.Request.Body, names)
+		}
+		if in.Response.BodyBytes == nil {
+			in.Response.Body = scrubBody(in.Response.Header.Get("Content-Type"), in.Response.Body, names)
+		}
+	}
+}
+
+func scrubBody(contentType, body string, names []string) string {
+	if body == "" {
+		return body
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(body)
+		if err != nil || !redactValues(form, names) {
+			return body
+		}
+		return form.Encode()
+	}
+
+	var doc interface{}
+	if json.Unmarshal([]byte(body), &doc) != nil || !redactJSON(doc, names) {
+		return body
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+	return string(data)
+}
+
+func redactValues(values url.Values, names []string) bool {
+	changed := false
+	for _, name := range names {
+		if vs, ok := values[name]; ok {
+			for i := range vs {
+				vs[i] = redacted
+			}
+			changed = true
+		}
+	}
+	return changed
+}
+
+func redactJSON(doc interface{}, names []string) bool {
+	changed := false
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if containsString(names, key) {
+				v[key] = redacted
+				changed = true
+			} else if redactJSON(value, names) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if redactJSON(value, names) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes what was recorded to the golden file. It does nothing in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode == ModeReplay {
+		return nil
+	}
+
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+func encodeBody(body []byte) (string, []byte) {
+	if utf8.Valid(body) {
+		return string(body), nil
+	}
+	return "", body
+}
+
+func decodeBody(text string, raw []byte) []byte {
+	if raw != nil {
+		return raw
+	}
+	if text == "" {
+		return nil
+	}
+	return []byte(text)
+}
@@ -0,0 +1,71 @@
+package requesttest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie-secret"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token_type":"bearer","access_token":"token-secret","nested":[{"refresh_token":"refresh-secret"}]}`))
+	}))
+	defer server.Close()
+
+	golden := filepath.Join(t.TempDir(), "exchange.json")
+	recorder, err := NewRecorder(golden, ModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.SetScrubbers(ScrubQuery("api_key"), ScrubFields("client_secret", "access_token", "refresh_token"))
+
+	newRequest := func() *http.Request {
+		u := strings.Replace(server.URL, "http://", "http://user:url-secret@", 1) + "/token?api_key=query-secret&q=1"
+		req, err := http.NewRequest(http.MethodPost, u, strings.NewReader("client_id=app&client_secret=form-secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+	res, err := recorder.RoundTrip(newRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"cookie-secret", "token-secret", "refresh-secret", "url-secret", "query-secret", "form-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("golden file contains %s", secret)
+		}
+	}
+	if !strings.Contains(string(data), "client_id=app") || !strings.Contains(string(data), "q=1") {
+		t.Errorf("scrubbing removed more than the secrets:\n%s", data)
+	}
+
+	replayer, err := NewRecorder(golden, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer.SetScrubbers(ScrubQuery("api_key"), ScrubFields("client_secret", "access_token", "refresh_token"))
+	res, err = replayer.RoundTrip(newRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if !strings.Contains(string(body), `"token_type":"bearer"`) {
+		t.Fatalf("unexpected replayed body %s", body)
+	}
+}
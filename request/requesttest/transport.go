@@ -0,0 +1,310 @@
+package requesttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoMatch = errors.New("requesttest: no expectation matches the request")
+
+// TestingT is the part of *testing.T used to report unmet expectations.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Transport is an http.RoundTripper answering from programmed expectations,
+// install it with request.WithTransport. Expectations are tried in the order
+// they were added; one that has used up its Times is skipped.
+type Transport struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []*Call
+}
+
+// Call is a request the transport has seen, with its body already read.
+type Call struct {
+	Request *http.Request
+	Body    []byte
+	// Expectation is nil when nothing matched.
+	Expectation *Expectation
+}
+
+type Expectation struct {
+	method   string
+	path     string
+	query    url.Values
+	header   http.Header
+	matchers []func(req *http.Request, body []byte) bool
+
+	status      int
+	replyHeader http.Header
+	replyBody   []byte
+	err         error
+	latency     time.Duration
+
+	times int
+	calls int
+}
+
+func NewTransport() *Transport {
+	return &Transport{}
+}
+
+// On expects a request with method, empty for any, to path, empty for any.
+func (t *Transport) On(method, path string) *Expectation {
+	e := &Expectation{
+		method:      method,
+		path:        path,
+		query:       url.Values{},
+		header:      http.Header{},
+		status:      http.StatusOK,
+		replyHeader: http.Header{},
+	}
+
+	t.mu.Lock()
+	t.expectations = append(t.expectations, e)
+	t.mu.Unlock()
+	return e
+}
+
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.query.Add(key, value)
+	return e
+}
+
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+func (e *Expectation) WithBody(body []byte) *Expectation {
+	return e.Match(func(req *http.Request, b []byte) bool {
+		return bytes.Equal(b, body)
+	})
+}
+
+// WithJSONBody matches bodies that decode to the same JSON as v.
+func (e *Expectation) WithJSONBody(v interface{}) *Expectation {
+	want, _ := json.Marshal(v)
+	return e.Match(func(req *http.Request, b []byte) bool {
+		var got, expected interface{}
+		return json.Unmarshal(b, &got) == nil && json.Unmarshal(want, &expected) == nil &&
+			reflect.DeepEqual(got, expected)
+	})
+}
+
+func (e *Expectation) Match(matcher func(req *http.Request, body []byte) bool) *Expectation {
+	e.matchers = append(e.matchers, matcher)
+	return e
+}
+
+func (e *Expectation) Reply(status int, body []byte) *Expectation {
+	e.status = status
+	e.replyBody = body
+	return e
+}
+
+func (e *Expectation) ReplyString(status int, body string) *Expectation {
+	return e.Reply(status, []byte(body))
+}
+
+func (e *Expectation) ReplyJSON(status int, v interface{}) *Expectation {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	e.replyHeader.Set("Content-Type", "application/json")
+	return e.Reply(status, body)
+}
+
+func (e *Expectation) ReplyHeader(key, value string) *Expectation {
+	e.replyHeader.Add(key, value)
+	return e
+}
+
+// ReplyError makes the round trip fail with err instead of responding.
+func (e *Expectation) ReplyError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Delay holds the response back, or until the request context is done.
+func (e *Expectation) Delay(latency time.Duration) *Expectation {
+	e.latency = latency
+	return e
+}
+
+// Times limits how often the expectation matches and makes
+// AssertExpectations require exactly n calls. Without it any number of
+// calls, at least one, is fine.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+func (e *Expectation) String() string {
+	var parts []string
+	method, path := e.method, e.path
+	if method == "" {
+		method = "*"
+	}
+	if path == "" {
+		path = "*"
+	}
+	parts = append(parts, method, path)
+	if len(e.query) > 0 {
+		parts = append(parts, "?"+e.query.Encode())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *Expectation) matches(req *http.Request, body []byte) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	if e.method != "" && !strings.EqualFold(e.method, req.Method) {
+		return false
+	}
+	if e.path != "" && e.path != req.URL.Path {
+		return false
+	}
+
+	query := req.URL.Query()
+	for key, values := range e.query {
+		if !containsAll(query[key], values) {
+			return false
+		}
+	}
+	for key, values := range e.header {
+		if !containsAll(req.Header[key], values) {
+			return false
+		}
+	}
+	for _, matcher := range e.matchers {
+		if !matcher(req, body) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	t.mu.Lock()
+	call := &Call{Request: req, Body: body}
+	t.calls = append(t.calls, call)
+	for _, e := range t.expectations {
+		if e.matches(req, body) {
+			e.calls++
+			call.Expectation = e
+			break
+		}
+	}
+	t.mu.Unlock()
+
+	e := call.Expectation
+	if e == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, req.Method, req.URL)
+	}
+
+	if e.latency > 0 {
+		timer := time.NewTimer(e.latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.status) + " " + http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.replyHeader.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.replyBody)),
+		ContentLength: int64(len(e.replyBody)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) Calls() []*Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*Call(nil), t.calls...)
+}
+
+// AssertExpectations reports expectations that were not called as often as
+// expected and requests that matched nothing.
+func (t *Transport) AssertExpectations(tt TestingT) bool {
+	if h, ok := tt.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ok := true
+	for _, e := range t.expectations {
+		switch {
+		case e.times > 0 && e.calls != e.times:
+			tt.Errorf("requesttest: expected %s to be called %d times, got %d", e, e.times, e.calls)
+			ok = false
+		case e.times == 0 && e.calls == 0:
+			tt.Errorf("requesttest: expected %s to be called", e)
+			ok = false
+		}
+	}
+	for _, call := range t.calls {
+		if call.Expectation == nil {
+			tt.Errorf("requesttest: unexpected request %s %s", call.Request.Method, call.Request.URL)
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,164 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const maxErrorBodySize = 512
+
+type Response struct {
+	Body       []byte
+	StatusCode int
+	Header     http.Header
+	// Elapsed covers every attempt and reading the body.
+	Elapsed time.Duration
+	// URL is where the request ended up after redirects.
+	URL *url.URL
+	// Redirects lists the URLs visited before URL, oldest first.
+	Redirects []*url.URL
+	// TLS is nil for plain http.
+	TLS *tls.ConnectionState
+	// Proto is the protocol the response came over, e.g. "HTTP/2.0".
+	Proto string
+	// Timing is nil unless the client was built with WithTiming.
+	Timing *Timing
+
+	Method   string
+	Attempts int
+}
+
+// StatusError is the cause of the *RequestError returned by
+// Response.EnsureSuccess for non-2xx responses. Body is truncated to a few
+// hundred bytes.
+type StatusError struct {
+	StatusCode int
+	URL        string
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s from %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL, e.Body)
+}
+
+func (r *Response) Is2XX() bool {
+	return r.StatusCode >= http.StatusOK && r.StatusCode < http.StatusMultipleChoices
+}
+
+func (r *Response) Is4XX() bool {
+	return r.StatusCode >= http.StatusBadRequest && r.StatusCode < http.StatusInternalServerError
+}
+
+func (r *Response) Is5XX() bool {
+	return r.StatusCode >= http.StatusInternalServerError && r.StatusCode < 600
+}
+
+func (r *Response) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// PeerCertificates returns the certificate chain presented by the server, leaf first.
+func (r *Response) PeerCertificates() []*x509.Certificate {
+	if r.TLS == nil {
+		return nil
+	}
+	return r.TLS.PeerCertificates
+}
+
+func (r *Response) EnsureSuccess() error {
+	if r.Is2XX() {
+		return nil
+	}
+
+	body := bytes.TrimSpace(truncate(r.Body, maxErrorBodySize))
+	var u string
+	if r.URL != nil {
+		u = redactURL(r.URL)
+	}
+	return &RequestError{
+		Method:     r.Method,
+		URL:        u,
+		Attempt:    r.Attempts,
+		StatusCode: r.StatusCode,
+		Body:       body,
+		Kind:       KindStatus,
+		Err:        &StatusError{StatusCode: r.StatusCode, URL: u, Body: body},
+	}
+}
+
+// Do sends a request and reads the whole body. When only reading the body
+// fails, the Response is returned without Body along with the error.
+func (client *baseClient) Do(ctx context.Context, method, url string, body []byte, headers ...*Header) (*Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	return client.doResponse(ctx, method, url, bodyReader, headers)
+}
+
+func (client *baseClient) doResponse(ctx context.Context, method, url string, body io.Reader, headers []*Header) (*Response, error) {
+	start := time.Now()
+
+	res, attempts, err := client.do(ctx, method, url, body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &Response{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		URL:        res.Request.URL,
+		Redirects:  redirectChain(res.Request),
+		TLS:        res.TLS,
+		Proto:      res.Proto,
+		Method:     method,
+		Attempts:   attempts,
+	}
+
+	data, err := client.readBody(res)
+	response.Elapsed = time.Since(start)
+	response.Timing = timingOf(res)
+	if err != nil {
+		reqErr := newRequestError(method, res.Request.URL, attempts, err)
+		reqErr.StatusCode = res.StatusCode
+		return response, reqErr
+	}
+	response.Body = data
+
+	return response, nil
+}
+
+func (client *baseClient) GetResponse(ctx context.Context, url string, headers ...*Header) (*Response, error) {
+	return client.Do(ctx, http.MethodGet, url, nil, headers...)
+}
+
+func (client *baseClient) PostResponse(ctx context.Context, url string, body []byte, headers ...*Header) (*Response, error) {
+	return client.Do(ctx, http.MethodPost, url, body, headers...)
+}
+
+func (client *baseClient) PatchResponse(ctx context.Context, url string, body []byte, headers ...*Header) (*Response, error) {
+	return client.Do(ctx, http.MethodPatch, url, body, headers...)
+}
+
+func (client *baseClient) PutResponse(ctx context.Context, url string, body []byte, headers ...*Header) (*Response, error) {
+	return client.Do(ctx, http.MethodPut, url, body, headers...)
+}
+
+func (client *baseClient) DeleteResponse(ctx context.Context, url string, headers ...*Header) (*Response, error) {
+	return client.Do(ctx, http.MethodDelete, url, nil, headers...)
+}
+
+func truncate(body []byte, size int) []byte {
+	if len(body) > size {
+		return body[:size]
+	}
+	return body
+}
@@ -0,0 +1,234 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRetryAttempts  = 3
+	DefaultRetryBaseDelay = time.Millisecond * 100
+	DefaultRetryMaxDelay  = time.Second * 2
+)
+
+var (
+	DefaultRetryStatusCodes = []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	IdempotentMethods = []string{
+		http.MethodHead,
+		http.MethodGet,
+		http.MethodPut,
+		http.MethodDelete,
+		http.MethodOptions,
+	}
+)
+
+// RetryPolicy describes when and how often a request is sent again.
+// Zero fields fall back to the Default* values above.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so 3 means up to two retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay caps the backoff. A Retry-After longer than MaxDelay ends
+	// the retries and the response is returned as is.
+	MaxDelay    time.Duration
+	StatusCodes []int
+	Methods     []string
+	// RetryError reports whether a transport error is worth another attempt,
+	// IsRetryableError is used when nil.
+	RetryError func(err error) bool
+}
+
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = &policy
+	}
+}
+
+// IsRetryableError reports whether err looks like a transient network failure:
+// timeouts, refused or reset connections and unexpected EOFs. Hosts that do
+// not resolve and addresses that cannot be dialed at all are not retried.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var addrErr *net.AddrError
+	var unknownNetwork net.UnknownNetworkError
+	var invalidAddr net.InvalidAddrError
+	if errors.As(err, &addrErr) || errors.As(err, &unknownNetwork) || errors.As(err, &invalidAddr) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (policy *RetryPolicy) maxAttempts() int {
+	if policy.MaxAttempts > 0 {
+		return policy.MaxAttempts
+	}
+	return DefaultRetryAttempts
+}
+
+func (policy *RetryPolicy) allowsMethod(method string) bool {
+	methods := policy.Methods
+	if methods == nil {
+		methods = IdempotentMethods
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *RetryPolicy) shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		if policy.RetryError != nil {
+			return policy.RetryError(err)
+		}
+		return IsRetryableError(err)
+	}
+
+	codes := policy.StatusCodes
+	if codes == nil {
+		codes = DefaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if code == res.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the next attempt and false when the
+// server asked for a longer pause than MaxDelay allows.
+func (policy *RetryPolicy) delay(attempt int, res *http.Response) (time.Duration, bool) {
+	base, max := policy.BaseDelay, policy.MaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+
+	if res != nil {
+		if wait, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			return wait, wait <= max
+		}
+	}
+
+	backoff := base << uint(attempt-1)
+	if backoff > max || backoff <= 0 {
+		backoff = max
+	}
+	// equal jitter: half fixed, half random
+	half := backoff / 2
+	return half + time.Duration(jitter(int64(half)+1)), true
+}
+
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func jitter(n int64) int64 {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return jitterRand.Int63n(n)
+}
+
+func (client *baseClient) sendWithRetry(req *http.Request) (*http.Response, int, error) {
+	policy := client.retry
+	if policy == nil || !policy.allowsMethod(req.Method) {
+		res, err := client.client.Do(req)
+		return res, 1, err
+	}
+	// a body that cannot be rewound is sent only once
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		res, err := client.client.Do(req)
+		return res, 1, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := client.client.Do(req)
+		if attempt >= policy.maxAttempts() || !policy.shouldRetry(res, err) || req.Context().Err() != nil {
+			return res, attempt, err
+		}
+
+		wait, ok := policy.delay(attempt, res)
+		if !ok {
+			return res, attempt, err
+		}
+		if res != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4<<10))
+			res.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, attempt, err
+			}
+			req.Body = body
+		}
+
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, attempt, err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	dial := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"connection refused", dial(os.NewSyscallError("connect", syscall.ECONNREFUSED)), true},
+		{"dns timeout", dial(&net.DNSError{Err: "timeout", Name: "example.com", IsTimeout: true}), true},
+		{"dns temporary", dial(&net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}), true},
+		{"no such host", dial(&net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}), false},
+		{"bad address", dial(&net.AddrError{Err: "missing port in address", Addr: "example.com"}), false},
+		{"unknown network", dial(net.UnknownNetworkError("tcp5")), false},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryableError(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryableError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryNoSuchHost(t *testing.T) {
+	calls := 0
+	client, err := New(WithRetry(RetryPolicy{BaseDelay: time.Millisecond}), WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: req.URL.Hostname(), IsNotFound: true}}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetResponse(context.Background(), "http://example.invalid/"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls != 1 {
+		t.Fatalf("sent %d times, want 1", calls)
+	}
+}
+
+// newFlakyServer answers status to the first failures requests, then 200,
+// and records the bodies it received.
+func newFlakyServer(t *testing.T, failures, status int, header http.Header) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		n := len(bodies)
+		mu.Unlock()
+
+		if n <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	tests := []struct {
+		method string
+		policy RetryPolicy
+	}{
+		{http.MethodPut, RetryPolicy{BaseDelay: time.Millisecond}},
+		{http.MethodPost, RetryPolicy{BaseDelay: time.Millisecond, Methods: []string{http.MethodPost}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			ts, bodies := newFlakyServer(t, 2, http.StatusServiceUnavailable, nil)
+			client, err := New(WithRetry(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Do(context.Background(), tt.method, ts.URL, []byte("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != http.StatusOK || res.Attempts != 3 {
+				t.Fatalf("status %d after %d attempts, want 200 after 3", res.StatusCode, res.Attempts)
+			}
+			for i, body := range bodies() {
+				if body != "payload" {
+					t.Fatalf("attempt %d sent %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetrySkipsPOSTByDefault(t *testing.T) {
+	ts, bodies := newFlakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	client, err := New(WithRetry(RetryPolicy{BaseDelay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.PostResponse(context.Background(), ts.URL, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusServiceUnavailable || res.Attempts != 1 || len(bodies()) != 1 {
+		t.Fatalf("status %d after %d attempts, want 503 after 1", res.StatusCode, res.Attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	ts, _ := newFlakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+	client, err := New(WithRetry(RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	res, err := client.GetResponse(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Attempts != 2 {
+		t.Fatalf("status %d after %d attempts, want 200 after 2", res.StatusCode, res.Attempts)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %v, want the 1s Retry-After", elapsed)
+	}
+
+	// a longer pause than MaxDelay returns the response as is
+	ts, _ = newFlakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}})
+	client, err = New(WithRetry(RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 100 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = client.GetResponse(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusTooManyRequests || res.Attempts != 1 {
+		t.Fatalf("status %d after %d attempts, want 429 after 1", res.StatusCode, res.Attempts)
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	ts, bodies := newFlakyServer(t, 100, http.StatusServiceUnavailable, nil)
+	client, err := New(WithRetry(RetryPolicy{MaxAttempts: 10, BaseDelay: time.Minute, MaxDelay: time.Minute}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.GetResponse(ctx, ts.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("returned after %v, want right after the deadline", elapsed)
+	}
+	if n := len(bodies()); n != 1 {
+		t.Fatalf("sent %d times, want 1", n)
+	}
+}
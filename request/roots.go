@@ -0,0 +1,163 @@
+package request
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WithSystemRoots keeps trusting the system roots when a CA is configured
+// with WithCA, WithCAFile, WithCAPaths or WithRootCAs, so the client reaches
+// both public endpoints and services signed by a private CA.
+func WithSystemRoots() Option {
+	return func(o *options) {
+		o.systemRoots = true
+	}
+}
+
+// WithCAPaths trusts the certificates in each path, a file or a directory
+// whose regular files are all read. PEM and DER are accepted; files in a
+// directory that hold no certificate are skipped.
+func WithCAPaths(paths ...string) Option {
+	return func(o *options) {
+		o.caPaths = append(o.caPaths, paths...)
+	}
+}
+
+type caFileData struct {
+	path    string
+	data    []byte
+	fromDir bool
+}
+
+// allCAPaths is the CA file followed by the WithCAPaths entries.
+func (o *options) allCAPaths() []string {
+	if o.caFile == "" {
+		return o.caPaths
+	}
+	return append([]string{o.caFile}, o.caPaths...)
+}
+
+func readCAPaths(paths []string) ([]caFileData, error) {
+	var files []caFileData
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, caFileData{path: path, data: data})
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := filepath.Join(path, entry.Name())
+			// follow links, e.g. the hash links in /etc/ssl/certs
+			if entry.Mode()&os.ModeSymlink != 0 {
+				if entry, err = os.Stat(name); err != nil {
+					continue
+				}
+			}
+			if !entry.Mode().IsRegular() {
+				continue
+			}
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, caFileData{path: name, data: data, fromDir: true})
+		}
+	}
+	return files, nil
+}
+
+// rootPool builds the pool servers are verified against from files read by
+// readCAPaths and the other CA options. It is nil when no CA is configured,
+// so the system roots are used.
+func (o *options) rootPool(files []caFileData) (*x509.CertPool, error) {
+	if !o.systemRoots && o.caBytes == nil && !o.requireCA && len(files) == 0 && len(o.rootCAs) == 0 {
+		return nil, nil
+	}
+
+	pool := x509.NewCertPool()
+	if o.systemRoots {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system roots: %v", err)
+		}
+		pool = system
+	}
+
+	if o.caBytes != nil || o.requireCA {
+		certs, err := parseCertificates(o.caBytes)
+		if err != nil {
+			return nil, errors.New("failed to parse root certificate")
+		}
+		addCerts(pool, certs)
+	}
+
+	for _, file := range files {
+		certs, err := parseCertificates(file.data)
+		if err != nil {
+			if file.fromDir {
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse root certificate %s: %v", file.path, err)
+		}
+		addCerts(pool, certs)
+	}
+
+	addCerts(pool, o.rootCAs)
+	return pool, nil
+}
+
+// parseCertificates reads the CERTIFICATE blocks of PEM data, or DER
+// certificates when data is not PEM.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		certs, err := x509.ParseCertificates(data)
+		if err == nil && len(certs) == 0 {
+			err = errors.New("no certificates found")
+		}
+		return certs, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		// skipped like AppendCertsFromPEM does
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+func addCerts(pool *x509.CertPool, certs []*x509.Certificate) {
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+}
@@ -0,0 +1,87 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+const DefaultMaxBodySize = 64 << 20
+
+var ErrBodyTooLarge = errors.New("response body exceeds the max body size")
+
+// StreamResponse hands the body over unread. The caller must close Body.
+// The client timeout still covers reading Body, so long downloads want
+// WithTimeout(0) and a deadline on the context instead.
+type StreamResponse struct {
+	StatusCode    int
+	Header        http.Header
+	ContentLength int64
+	URL           *url.URL
+	Redirects     []*url.URL
+	Proto         string
+	Body          io.ReadCloser
+}
+
+// WithMaxBodySize limits how much Get, Post, Patch, Put and Delete read into
+// memory. Zero or a negative size disables the limit. Streams are never limited.
+// The legacy constructors such as NewHttpClient keep no limit for compatibility;
+// New, NewHttpsClientWithOptions and NewHttpsClientX509WithOptions default to
+// DefaultMaxBodySize and accept this option.
+func WithMaxBodySize(size int64) Option {
+	return func(o *options) {
+		o.maxBodySize = size
+	}
+}
+
+func (client *baseClient) Stream(ctx context.Context, method, url string, body io.Reader, headers ...*Header) (*StreamResponse, error) {
+	res, _, err := client.do(ctx, method, url, body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamResponse{
+		StatusCode:    res.StatusCode,
+		Header:        res.Header,
+		ContentLength: res.ContentLength,
+		URL:           res.Request.URL,
+		Redirects:     redirectChain(res.Request),
+		Proto:         res.Proto,
+		Body:          res.Body,
+	}, nil
+}
+
+func (client *baseClient) GetStream(ctx context.Context, url string, headers ...*Header) (*StreamResponse, error) {
+	return client.Stream(ctx, http.MethodGet, url, nil, headers...)
+}
+
+func (client *baseClient) PostStream(ctx context.Context, url string, body io.Reader, headers ...*Header) (*StreamResponse, error) {
+	return client.Stream(ctx, http.MethodPost, url, body, headers...)
+}
+
+func (client *baseClient) PutStream(ctx context.Context, url string, body io.Reader, headers ...*Header) (*StreamResponse, error) {
+	return client.Stream(ctx, http.MethodPut, url, body, headers...)
+}
+
+func (client *baseClient) readBody(res *http.Response) ([]byte, error) {
+	defer res.Body.Close()
+
+	if client.maxBodySize <= 0 {
+		return ioutil.ReadAll(res.Body)
+	}
+	if res.ContentLength > client.maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, client.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > client.maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
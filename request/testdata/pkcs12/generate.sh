@@ -0,0 +1,47 @@
+#!/bin/sh
+# Regenerates the PKCS#12 and encrypted key fixtures with OpenSSL 3.
+# The password of every encrypted file is "s3cret".
+set -e
+cd "$(dirname "$0")"
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+key() {
+	openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -out "$1"
+}
+
+key ca.key
+openssl req -x509 -new -key ca.key -subj "/CN=Test Root CA" -days 36500 \
+	-addext "basicConstraints=critical,CA:true" -addext "keyUsage=critical,keyCertSign" -out ca.pem
+
+key "$tmp/int.key"
+openssl req -new -key "$tmp/int.key" -subj "/CN=Test Intermediate CA" -out "$tmp/int.csr"
+printf 'basicConstraints=critical,CA:true\nkeyUsage=critical,keyCertSign\n' >"$tmp/int.ext"
+openssl x509 -req -in "$tmp/int.csr" -CA ca.pem -CAkey ca.key -CAcreateserial -days 36500 \
+	-extfile "$tmp/int.ext" -out int.pem
+
+key client.key
+openssl req -new -key client.key -subj "/CN=client" -out "$tmp/client.csr"
+printf 'extendedKeyUsage=clientAuth\n' >"$tmp/client.ext"
+openssl x509 -req -in "$tmp/client.csr" -CA int.pem -CAkey "$tmp/int.key" -CAcreateserial -days 36500 \
+	-extfile "$tmp/client.ext" -out client.pem
+cat int.pem ca.pem >"$tmp/chain.pem"
+
+# OpenSSL 3 defaults: PBES2 with AES-256-CBC and PBKDF2-HMAC-SHA256, SHA-256 MAC
+openssl pkcs12 -export -inkey client.key -in client.pem -certfile "$tmp/chain.pem" \
+	-passout pass:s3cret -out aes.p12
+openssl pkcs12 -export -inkey client.key -in client.pem -certfile "$tmp/chain.pem" \
+	-keypbe PBE-SHA1-3DES -certpbe PBE-SHA1-3DES -macalg sha1 -passout pass:s3cret -out 3des.p12
+openssl pkcs12 -export -inkey client.key -in client.pem -certfile "$tmp/chain.pem" \
+	-passout pass: -out nopass.p12
+openssl pkcs12 -export -inkey client.key -in client.pem -passout pass:s3cret -out noca.p12
+openssl pkcs12 -export -legacy -inkey client.key -in client.pem -passout pass:s3cret -out rc2.p12
+openssl pkcs12 -export -legacy -inkey client.key -in client.pem -certfile "$tmp/chain.pem" \
+	-keypbe PBE-SHA1-3DES -certpbe PBE-SHA1-RC2-128 -passout pass:s3cret -out rc2-128.p12
+
+openssl pkcs8 -topk8 -in client.key -v2 aes-128-cbc -v2prf hmacWithSHA512 -passout pass:s3cret -out client.pbes2.key
+openssl pkcs8 -topk8 -in client.key -v1 PBE-SHA1-3DES -passout pass:s3cret -out client.3des.key
+openssl ec -in client.key -aes256 -passout pass:s3cret -out client.legacy.key
+
+rm -f ca.key ca.srl int.srl
@@ -0,0 +1,126 @@
+package request
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing breaks down the last attempt of a request. Phases that did not
+// happen, like DNS for an IP address or everything up to the request on a
+// reused connection, are zero.
+type Timing struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte runs from the request being written to the first
+	// response byte, roughly the time the server spent on it.
+	TimeToFirstByte time.Duration
+	// Transfer runs from the first response byte until the body was read or closed.
+	Transfer   time.Duration
+	ConnReused bool
+	RemoteAddr string
+}
+
+// WithTiming records a Timing for every request with net/http/httptrace.
+// It is set on Response and RequestInfo, and onTiming, which may be nil,
+// receives it once the body has been read or closed, streams included.
+func WithTiming(onTiming func(info RequestInfo)) Option {
+	return func(o *options) {
+		o.timing = true
+		o.onTiming = onTiming
+	}
+}
+
+type timingTrace struct {
+	mu           sync.Mutex
+	timing       Timing
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wrote        time.Time
+	firstByte    time.Time
+}
+
+func (t *timingTrace) update(f func(now time.Time)) {
+	now := time.Now()
+	t.mu.Lock()
+	f(now)
+	t.mu.Unlock()
+}
+
+func (t *timingTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		// every retry and redirect asks for a connection again, keep only the last
+		GetConn: func(string) {
+			t.update(func(time.Time) {
+				t.timing = Timing{}
+				t.connectStart, t.wrote, t.firstByte = time.Time{}, time.Time{}, time.Time{}
+			})
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.update(func(now time.Time) { t.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.update(func(now time.Time) { t.timing.DNS = now.Sub(t.dnsStart) })
+		},
+		// dialing several addresses in parallel reports a start for each
+		ConnectStart: func(string, string) {
+			t.update(func(now time.Time) {
+				if t.connectStart.IsZero() {
+					t.connectStart = now
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.update(func(now time.Time) { t.timing.Connect = now.Sub(t.connectStart) })
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.update(func(now time.Time) { t.tlsStart = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.update(func(now time.Time) { t.timing.TLSHandshake = now.Sub(t.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.update(func(time.Time) {
+				t.timing.ConnReused = info.Reused
+				t.timing.RemoteAddr = info.Conn.RemoteAddr().String()
+			})
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.update(func(now time.Time) { t.wrote = now })
+		},
+		GotFirstResponseByte: func() {
+			t.update(func(now time.Time) {
+				t.firstByte = now
+				if !t.wrote.IsZero() {
+					t.timing.TimeToFirstByte = now.Sub(t.wrote)
+				}
+			})
+		},
+	}
+}
+
+// finish completes the transfer phase and returns a copy of the breakdown.
+func (t *timingTrace) finish() *Timing {
+	var timing Timing
+	t.update(func(now time.Time) {
+		if !t.firstByte.IsZero() {
+			t.timing.Transfer = now.Sub(t.firstByte)
+		}
+		timing = t.timing
+	})
+	return &timing
+}
+
+// timingOf returns the breakdown of res, available once its body is closed.
+func timingOf(res *http.Response) *Timing {
+	if body, ok := res.Body.(*observedBody); ok {
+		return body.obs.info.Timing
+	}
+	return nil
+}
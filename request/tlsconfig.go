@@ -0,0 +1,132 @@
+package request
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+func (o *options) tlsConfig() (*tls.Config, error) {
+	if o.certReload != nil && (len(o.allCAPaths()) > 0 || o.certFile != "") {
+		return o.reloadingTLSConfig()
+	}
+
+	files, err := readCAPaths(o.allCAPaths())
+	if err != nil {
+		return nil, errors.New("Unable to read cert.pem: " + err.Error())
+	}
+	roots, err := o.rootPool(files)
+	if err != nil {
+		return nil, err
+	}
+
+	certBytes, keyBytes := o.certBytes, o.keyBytes
+	if o.certFile != "" || o.keyFile != "" {
+		b, err := ioutil.ReadFile(o.certFile)
+		if err != nil {
+			return nil, err
+		}
+		certBytes = b
+		if b, err = ioutil.ReadFile(o.keyFile); err != nil {
+			return nil, err
+		}
+		keyBytes = b
+	}
+
+	if roots == nil && certBytes == nil && o.clientCert == nil && !o.insecureSkipVerify && !o.peer.enabled() && o.peer.serverName == "" && !o.tls.configured() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.insecureSkipVerify,
+		RootCAs:            roots,
+	}
+	o.tls.apply(tlsConfig)
+
+	if o.clientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*o.clientCert}
+	} else if certBytes != nil || o.requireClientCert {
+		cert, err := X509KeyPairWithPassword(certBytes, keyBytes, o.keyPassword)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	o.applyPeerVerification(tlsConfig, func() *x509.CertPool { return roots }, false)
+	return tlsConfig, nil
+}
+
+// reloadingTLSConfig verifies servers and presents client certificates with
+// whatever material the reloader currently holds.
+func (o *options) reloadingTLSConfig() (*tls.Config, error) {
+	// a key pair given as bytes never changes, only its files are reloaded
+	staticCert := o.clientCert
+	if o.certFile == "" && staticCert == nil && (o.certBytes != nil || o.requireClientCert) {
+		cert, err := X509KeyPairWithPassword(o.certBytes, o.keyBytes, o.keyPassword)
+		if err != nil {
+			return nil, err
+		}
+		staticCert = &cert
+	}
+
+	reloader, err := newCertReloader(o)
+	if err != nil {
+		return nil, err
+	}
+	o.reloader = reloader
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.insecureSkipVerify,
+		RootCAs:            reloader.currentRoots(),
+	}
+	o.tls.apply(tlsConfig)
+	if o.certFile != "" {
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
+	} else if staticCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*staticCert}
+	}
+	// the built-in check only knows a fixed RootCAs, so a reloaded CA needs our own
+	o.applyPeerVerification(tlsConfig, reloader.currentRoots, len(reloader.caPaths) > 0)
+	return tlsConfig, nil
+}
+
+// applyPeerVerification adds pins, expected names and the custom callback to
+// the certificate checks. crypto/tls keeps verifying the chain and the dialed
+// host, IP addresses included, unless expected names, pin-only mode or roots
+// that change over time require verifying the chain ourselves.
+func (o *options) applyPeerVerification(tlsConfig *tls.Config, roots func() *x509.CertPool, dynamicRoots bool) {
+	peer := o.peer
+	if peer.serverName != "" {
+		tlsConfig.ServerName = peer.serverName
+	}
+	if !peer.enabled() && !dynamicRoots {
+		return
+	}
+
+	insecure := tlsConfig.InsecureSkipVerify
+	if !insecure && !peer.pinOnly() && !dynamicRoots && len(peer.expectedNames) == 0 {
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return peer.verify(cs, cs.VerifiedChains)
+		}
+		return
+	}
+
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		var chains [][]*x509.Certificate
+		switch {
+		case peer.pinOnly():
+			if err := peer.verifyLeafName(cs); err != nil {
+				return err
+			}
+		case !insecure:
+			var err error
+			if chains, err = peer.verifyChain(cs, roots()); err != nil {
+				return err
+			}
+		}
+		return peer.verify(cs, chains)
+	}
+}
@@ -0,0 +1,166 @@
+package request
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+type TLSProfile int
+
+const (
+	// TLSProfileDefault leaves versions, ciphers and curves to crypto/tls.
+	TLSProfileDefault TLSProfile = iota
+	// TLSProfileModern allows TLS 1.3 only.
+	TLSProfileModern
+	// TLSProfileIntermediate allows TLS 1.2 with forward secret AEAD ciphers
+	// and TLS 1.3, as Mozilla's intermediate configuration does.
+	TLSProfileIntermediate
+	// TLSProfileFIPS allows TLS 1.2 with ECDHE AES-GCM ciphers on the NIST
+	// curves. It stops at TLS 1.2 because crypto/tls does not let TLS 1.3
+	// suites be restricted, and ChaCha20-Poly1305 is not FIPS approved.
+	TLSProfileFIPS
+)
+
+var intermediateCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// tlsSettings are the handshake parameters, zero values leave the profile
+// or crypto/tls default in place.
+type tlsSettings struct {
+	profile      TLSProfile
+	minVersion   uint16
+	maxVersion   uint16
+	cipherSuites []uint16
+	curves       []tls.CurveID
+	nextProtos   []string
+	sessionCache tls.ClientSessionCache
+}
+
+// WithTLSProfile starts from a named set of versions, ciphers and curves;
+// WithTLSVersions, WithCipherSuites and WithCurvePreferences override parts of it.
+func WithTLSProfile(profile TLSProfile) Option {
+	return func(o *options) {
+		if profile < TLSProfileDefault || profile > TLSProfileFIPS {
+			o.setErr(fmt.Errorf("unknown TLS profile %d", profile))
+			return
+		}
+		o.tls.profile = profile
+	}
+}
+
+// WithTLSVersions bounds the negotiated version, e.g. tls.VersionTLS12.
+// Zero keeps the profile's bound.
+func WithTLSVersions(min, max uint16) Option {
+	return func(o *options) {
+		if min != 0 && max != 0 && min > max {
+			o.setErr(fmt.Errorf("TLS min version %#04x is above max version %#04x", min, max))
+			return
+		}
+		o.tls.minVersion = min
+		o.tls.maxVersion = max
+	}
+}
+
+// WithCipherSuites restricts the TLS 1.0-1.2 cipher suites, TLS 1.3 suites
+// are not configurable.
+func WithCipherSuites(ids ...uint16) Option {
+	return func(o *options) {
+		known := map[uint16]bool{}
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			known[suite.ID] = true
+		}
+		for _, id := range ids {
+			if !known[id] {
+				o.setErr(fmt.Errorf("unknown cipher suite %#04x", id))
+				return
+			}
+		}
+		o.tls.cipherSuites = ids
+	}
+}
+
+func WithCurvePreferences(curves ...tls.CurveID) Option {
+	return func(o *options) {
+		o.tls.curves = curves
+	}
+}
+
+// WithALPN offers protos during the handshake. Offering "h2" enables HTTP/2
+// as WithHTTP2 does, since the transport has to speak what the server picks.
+func WithALPN(protos ...string) Option {
+	return func(o *options) {
+		o.tls.nextProtos = protos
+	}
+}
+
+// WithSessionCache keeps up to capacity TLS session tickets, zero meaning
+// the crypto/tls default, so new connections resume instead of doing a full
+// handshake. It matters most with WithKeepAlive(false), where every request dials.
+func WithSessionCache(capacity int) Option {
+	return func(o *options) {
+		o.tls.sessionCache = tls.NewLRUClientSessionCache(capacity)
+	}
+}
+
+func (s *tlsSettings) configured() bool {
+	return s.profile != TLSProfileDefault || s.minVersion != 0 || s.maxVersion != 0 ||
+		s.cipherSuites != nil || s.curves != nil || s.nextProtos != nil || s.sessionCache != nil
+}
+
+func (s *tlsSettings) offersHTTP2() bool {
+	for _, proto := range s.nextProtos {
+		if proto == "h2" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *tlsSettings) apply(tlsConfig *tls.Config) {
+	switch s.profile {
+	case TLSProfileModern:
+		tlsConfig.MinVersion = tls.VersionTLS13
+		tlsConfig.CurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+	case TLSProfileIntermediate:
+		tlsConfig.MinVersion = tls.VersionTLS12
+		tlsConfig.CipherSuites = intermediateCipherSuites
+		tlsConfig.CurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+	case TLSProfileFIPS:
+		tlsConfig.MinVersion = tls.VersionTLS12
+		tlsConfig.MaxVersion = tls.VersionTLS12
+		tlsConfig.CipherSuites = fipsCipherSuites
+		tlsConfig.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+	}
+
+	if s.minVersion != 0 {
+		tlsConfig.MinVersion = s.minVersion
+	}
+	if s.maxVersion != 0 {
+		tlsConfig.MaxVersion = s.maxVersion
+	}
+	if s.cipherSuites != nil {
+		tlsConfig.CipherSuites = s.cipherSuites
+	}
+	if s.curves != nil {
+		tlsConfig.CurvePreferences = s.curves
+	}
+	if s.nextProtos != nil {
+		tlsConfig.NextProtos = s.nextProtos
+	}
+	if s.sessionCache != nil {
+		tlsConfig.ClientSessionCache = s.sessionCache
+	}
+}
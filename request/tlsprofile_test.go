@@ -0,0 +1,43 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestALPNProtocols(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		protos []string
+		want   string
+	}{
+		{"h2 only", []string{"h2"}, "HTTP/2.0"},
+		{"h2 preferred", []string{"h2", "http/1.1"}, "HTTP/2.0"},
+		{"http/1.1 only", []string{"http/1.1"}, "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(WithALPN(tt.protos...), WithRootCAs(server.Certificate()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.GetResponse(context.Background(), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(res.Body) != tt.want || res.Proto != tt.want {
+				t.Fatalf("server saw %s, response came over %s, want %s", res.Body, res.Proto, tt.want)
+			}
+		})
+	}
+}